@@ -0,0 +1,381 @@
+package check
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+type Type int
+
+const (
+	Any Type = iota // type is not known before evaluation
+	Number
+	String
+	Bool
+	Time
+	Duration
+	Null
+)
+
+func (t Type) String() string {
+	switch t {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	case Time:
+		return "time"
+	case Duration:
+		return "duration"
+	case Null:
+		return "null"
+	}
+	return "any"
+}
+
+// TypeOf returns the rule type of a go type.
+func TypeOf(t reflect.Type) Type {
+	switch t {
+	case nil:
+		return Any
+	case timeType:
+		return Time
+	case durationType:
+		return Duration
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return Number
+	case reflect.String:
+		return String
+	case reflect.Bool:
+		return Bool
+	}
+	return Any
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+func compatible(a, b Type) bool {
+	return a == Any || b == Any || a == Null || b == Null || a == b
+}
+
+type Error struct {
+	parse.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("type error at rule %d char %d: %s", e.Index, e.Char, e.Msg)
+}
+
+// Errors holds every type error found in a rule set.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i := range e {
+		s[i] = e[i].Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+type checker struct {
+	funcMap     map[string]interface{}
+	inputMap    map[string]interface{}
+	outputs     map[string]Type
+	outputTypes map[string]reflect.Type
+	typeChanges bool
+	errs        Errors
+}
+
+// Option configures Check, to match the options of the evaluator.
+type Option func(*checker)
+
+// WithOutputType declares the type of an output, like eval.WithOutputType.
+// It wins over the type of the value of the output in outputMap.
+func WithOutputType(output string, t reflect.Type) Option {
+	return func(c *checker) {
+		if c.outputTypes == nil {
+			c.outputTypes = make(map[string]reflect.Type)
+		}
+		c.outputTypes[output] = t
+	}
+}
+
+// WithTypeChanges accepts assignments that change the type of an output,
+// like eval.WithTypeChanges. The output is of any type after such an
+// assignment.
+func WithTypeChanges() Option {
+	return func(c *checker) {
+		c.typeChanges = true
+	}
+}
+
+// Check infers the type of every expression from the input values, the
+// function signatures and the assignments, and reports all type errors
+// before the rules are evaluated.
+func Check(ast parse.AST, funcMap, inputMap, outputMap map[string]interface{}, opts ...Option) error {
+	c := &checker{
+		funcMap:  funcMap,
+		inputMap: inputMap,
+		outputs:  make(map[string]Type),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	for k, v := range outputMap {
+		c.outputs[k] = TypeOf(reflect.TypeOf(v))
+	}
+	for k, t := range c.outputTypes {
+		c.outputs[k] = TypeOf(t)
+	}
+	c.engine(ast.Node)
+	if len(c.errs) > 0 {
+		return c.errs
+	}
+	return nil
+}
+
+func (c *checker) errorf(pos parse.Position, format string, args ...interface{}) {
+	c.errs = append(c.errs, &Error{
+		Position: pos,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) engine(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.EngineNode:
+		for i := range n.Rules {
+			c.rule(&n.Rules[i])
+		}
+	case parse.EngineNode:
+		for i := range n.Rules {
+			c.rule(&n.Rules[i])
+		}
+	}
+}
+
+// rule checks a rule. A condition can be of any type, the evaluator takes
+// zero values, empty strings and null as false.
+func (c *checker) rule(node *parse.RuleNode) {
+	if node.Condition != nil {
+		c.expression(node.Condition)
+	}
+	for i := range node.Actions {
+		c.assignment(&node.Actions[i])
+	}
+}
+
+func (c *checker) assignment(node *parse.AssingmentNode) {
+	t := c.expression(node.RightExpression)
+	name := node.Variable.Identifier
+	old, ok := c.outputs[name]
+	switch node.Operator {
+	case "", "=":
+	case "append":
+		if ok && old != Any && old != Null {
+			c.errorf(node.Pos(), "cannot append to %q of type %s", name, old)
+		}
+		c.outputs[name] = Any
+		return
+	default:
+		if !ok || old == Any || old == Null {
+			if _, valid := mathType(node.Operator[:1], t, t); !valid && t != Any {
+				c.errorf(node.Pos(), "operator %s not defined on %s", node.Operator, t)
+			}
+			c.outputs[name] = t
+			return
+		}
+		if r, valid := mathType(node.Operator[:1], old, t); !valid || !compatible(old, r) {
+			c.errorf(node.Pos(), "operator %s not defined on %q of type %s and %s", node.Operator, name, old, t)
+		}
+		return
+	}
+	if !ok || old == Any {
+		c.outputs[name] = t
+		return
+	}
+	switch {
+	case compatible(old, t):
+	case c.typeChanges:
+		c.outputs[name] = Any
+	default:
+		c.errorf(node.Pos(), "cannot assign %s to %q of type %s", t, name, old)
+	}
+}
+
+func (c *checker) expression(node parse.Node) Type {
+	switch n := node.(type) {
+	case *parse.ExpressionNode:
+		if n == nil {
+			return Any
+		}
+		return c.expression(n.Expression)
+	case parse.ExpressionNode:
+		return c.expression(n.Expression)
+	case *parse.NumberNode, parse.NumberNode:
+		return Number
+	case *parse.StringNode, parse.StringNode:
+		return String
+	case *parse.BoolNode, parse.BoolNode:
+		return Bool
+	case *parse.DurationNode, parse.DurationNode:
+		return Duration
+	case *parse.DateNode, parse.DateNode:
+		return Time
+	case *parse.NullNode, parse.NullNode:
+		return Null
+	case *parse.ExistsNode, parse.ExistsNode:
+		return Bool
+	case *parse.NotNode:
+		return c.not(n)
+	case parse.NotNode:
+		return c.not(&n)
+	case *parse.IdentifierNode:
+		return c.identifier(n)
+	case parse.IdentifierNode:
+		return c.identifier(&n)
+	case *parse.FunctionNode:
+		return c.function(n)
+	case parse.FunctionNode:
+		return c.function(&n)
+	case *parse.MathExpressionNode:
+		return c.math(n)
+	case parse.MathExpressionNode:
+		return c.math(&n)
+	case *parse.ConditionalExpressionNode:
+		return c.conditional(n)
+	case parse.ConditionalExpressionNode:
+		return c.conditional(&n)
+	}
+	return Any
+}
+
+func (c *checker) not(node *parse.NotNode) Type {
+	// Like conditions, ! takes any value.
+	c.expression(node.Expression)
+	return Bool
+}
+
+func (c *checker) identifier(node *parse.IdentifierNode) Type {
+	if len(node.Path) > 0 {
+		return Any
+	}
+	if node.IsInput {
+		return TypeOf(reflect.TypeOf(c.inputMap[node.Identifier]))
+	}
+	return c.outputs[node.Identifier]
+}
+
+func (c *checker) function(node *parse.FunctionNode) Type {
+	args := make([]Type, len(node.Args))
+	for i := range node.Args {
+		args[i] = c.expression(&node.Args[i])
+	}
+	ft := reflect.TypeOf(c.funcMap[node.Function])
+	if ft == nil || ft.Kind() != reflect.Func {
+		c.errorf(node.Pos(), "%s is not a function", node.Function)
+		return Any
+	}
+	for i, at := range args {
+		var pt reflect.Type
+		switch {
+		case ft.IsVariadic() && i >= ft.NumIn()-1:
+			pt = ft.In(ft.NumIn() - 1).Elem()
+		case i < ft.NumIn():
+			pt = ft.In(i)
+		default:
+			continue
+		}
+		if want := TypeOf(pt); !compatible(want, at) {
+			c.errorf(node.Args[i].Pos(), "argument %d of %s must be %s, got %s", i+1, node.Function, want, at)
+		}
+	}
+	if ft.NumOut() == 0 {
+		return Any
+	}
+	return TypeOf(ft.Out(0))
+}
+
+func (c *checker) math(node *parse.MathExpressionNode) Type {
+	l := c.expression(node.LeftExpression)
+	r := c.expression(node.RightExpression)
+	if node.IsCoalesce {
+		if !compatible(l, r) {
+			c.errorf(node.Pos(), "mismatched types %s and %s in ??", l, r)
+		}
+		if l == Any || l == Null {
+			return r
+		}
+		return l
+	}
+	t, ok := mathType(node.Identifier, l, r)
+	if !ok {
+		c.errorf(node.Pos(), "operator %s not defined on %s and %s", node.Identifier, l, r)
+	}
+	return t
+}
+
+// mathType returns the type of an arithmetic operation, it mirrors the
+// arithmetic of numbers, dates and durations in the evaluator.
+func mathType(op string, l, r Type) (Type, bool) {
+	if l == Null || r == Null {
+		return Any, false
+	}
+	if l == Any || r == Any {
+		if l == String || l == Bool || r == String || r == Bool {
+			return Any, false
+		}
+		return Any, true
+	}
+	switch {
+	case l == Number && r == Number:
+		return Number, true
+	case l == Time && r == Time && op == "-":
+		return Duration, true
+	case l == Time && r == Duration && (op == "+" || op == "-"):
+		return Time, true
+	case l == Duration && r == Time && op == "+":
+		return Time, true
+	case l == Duration && r == Duration && (op == "+" || op == "-" || op == "%"):
+		return Duration, true
+	case l == Duration && r == Duration && op == "/":
+		return Number, true
+	case l == Duration && r == Number && (op == "*" || op == "/"):
+		return Duration, true
+	case l == Number && r == Duration && op == "*":
+		return Duration, true
+	}
+	return Any, false
+}
+
+func (c *checker) conditional(node *parse.ConditionalExpressionNode) Type {
+	l := c.expression(node.LeftExpression)
+	r := c.expression(node.RightExpression)
+	switch node.Identifier {
+	case "&&", "||":
+		// Operands are truthy values, like conditions.
+	case "==", "!=":
+		if !compatible(l, r) {
+			c.errorf(node.Pos(), "mismatched types %s and %s in %s", l, r, node.Identifier)
+		}
+	default:
+		if l == Null || r == Null || !compatible(l, r) || (l != Any && l != Number && l != Time && l != Duration) || (r != Any && r != Number && r != Time && r != Duration) {
+			c.errorf(node.Pos(), "operator %s not defined on %s and %s", node.Identifier, l, r)
+		}
+	}
+	return Bool
+}
@@ -0,0 +1,143 @@
+package check
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+var (
+	testFuncs = map[string]interface{}{
+		"sqrt": math.Sqrt,
+		"max": func(n ...float64) float64 {
+			return 0
+		},
+		"upper": strings.ToUpper,
+	}
+	testInputs = map[string]interface{}{
+		"a":     2,
+		"total": 120.0,
+		"name":  "x",
+		"vip":   true,
+		"at":    time.Time{},
+		"wait":  time.Hour,
+		"user":  map[string]interface{}{},
+	}
+	testOutputs = map[string]interface{}{
+		"x":     0.0,
+		"label": "",
+		"ok":    false,
+		"tags":  []interface{}{},
+	}
+)
+
+func checkRules(t *testing.T, rules ...string) error {
+	t.Helper()
+	ast, err := parse.Parse(rules, testFuncs, testInputs, testOutputs)
+	if err != nil {
+		t.Fatalf("%q: %v", rules, err)
+	}
+	return Check(ast, testFuncs, testInputs, testOutputs)
+}
+
+func TestCheckAccepted(t *testing.T) {
+	for _, rule := range []string{
+		// Conditions are truthy values.
+		"a | x = 1",
+		"name | label = name",
+		"!a | x = 2",
+		"name && vip | ok = true",
+		"a || name | ok = !vip",
+		"total > 100 && vip | x = total * 0.1",
+		"x = sqrt(total) + max(1, a, total)",
+		"label = upper(name)",
+		"at - at > wait | ok = true",
+		"x = (wait + wait) / wait",
+		"user.plan == \"gold\" | x = user.limit",
+		"x = user.limit ?? 1",
+		"x += 1",
+		"tags append name",
+		"label = null",
+	} {
+		if err := checkRules(t, rule); err != nil {
+			t.Errorf("%q: %v", rule, err)
+		}
+	}
+}
+
+func TestCheckRejected(t *testing.T) {
+	for _, c := range []struct {
+		rules []string
+		err   string
+	}{
+		{[]string{`total > "a" | x = 1`}, "type error at rule 0 char 7: operator > not defined on number and string"},
+		{[]string{`x = 1`, `name == 1 | x = 2`}, "type error at rule 1 char 7: mismatched types string and number in =="},
+		{[]string{`label = 1`}, `cannot assign number to "label" of type string`},
+		{[]string{`label += 1`}, `operator += not defined on "label" of type string and number`},
+		{[]string{`x append 1`}, `cannot append to "x" of type number`},
+		{[]string{`x = name * 2`}, "operator * not defined on string and number"},
+		{[]string{`x = sqrt(name)`}, "argument 1 of sqrt must be number, got string"},
+		{[]string{`x = max(1, name)`}, "argument 2 of max must be number, got string"},
+		{[]string{`vip < at | x = 1`}, "operator < not defined on bool and time"},
+		{[]string{`x = total ?? name`}, "mismatched types number and string in ??"},
+	} {
+		err := checkRules(t, c.rules...)
+		if err == nil {
+			t.Errorf("%q: no error, want %q", c.rules, c.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: error %q does not contain %q", c.rules, err, c.err)
+		}
+	}
+}
+
+func TestCheckAllErrors(t *testing.T) {
+	err := checkRules(t, `label = 1`, `x = name * 2`)
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("error %v is not Errors", err)
+	}
+	if len(errs) != 2 || errs[0].Index != 0 || errs[1].Index != 1 {
+		t.Errorf("errors = %v, want one in each rule", errs)
+	}
+}
+
+func TestCheckOptions(t *testing.T) {
+	checkWith := func(rules []string, opts ...Option) error {
+		t.Helper()
+		ast, err := parse.Parse(rules, testFuncs, testInputs, testOutputs)
+		if err != nil {
+			t.Fatalf("%q: %v", rules, err)
+		}
+		return Check(ast, testFuncs, testInputs, testOutputs, opts...)
+	}
+	intType := reflect.TypeOf(int(0))
+
+	// A declared type wins over the value in the outputs.
+	if err := checkWith([]string{"n = 1", "label = name"}, WithOutputType("n", intType)); err != nil {
+		t.Error(err)
+	}
+	if err := checkWith([]string{"n = name"}, WithOutputType("n", intType)); err == nil || !strings.Contains(err.Error(), `cannot assign string to "n" of type number`) {
+		t.Errorf("n = name: error %v", err)
+	}
+	if err := checkWith([]string{"label = 1"}, WithOutputType("label", intType)); err != nil {
+		t.Error(err)
+	}
+
+	// Type changes are accepted, and the output is of any type after them.
+	if err := checkWith([]string{"label = 1", "x = label * 2"}, WithTypeChanges()); err != nil {
+		t.Error(err)
+	}
+	if err := checkWith([]string{"label = 1"}, WithOutputType("label", reflect.TypeOf("")), WithTypeChanges()); err != nil {
+		t.Error(err)
+	}
+	// They do not make invalid operators valid.
+	if err := checkWith([]string{"label += 1"}, WithTypeChanges()); err == nil {
+		t.Error("label += 1: no error")
+	}
+}
@@ -0,0 +1,397 @@
+// Command mosalat evaluates, checks, formats and dumps rule files, and runs
+// rules interactively.
+//
+// A rule file holds one rule per line, blank lines and lines starting with
+// # are skipped. Inputs and initial outputs are JSON objects, rules can call
+// the functions of the stdlib package.
+//
+// The exit status is 0 on success, 1 for usage and I/O errors, 2 for syntax
+// errors, 3 for type errors, 4 for errors while evaluating and 5 when a rule
+// test case fails.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/sazito/mosalat/check"
+	"github.com/sazito/mosalat/eval"
+	"github.com/sazito/mosalat/parse"
+	"github.com/sazito/mosalat/serialize"
+	"github.com/sazito/mosalat/stdlib"
+)
+
+const (
+	exitOK = iota
+	exitUsage
+	exitSyntax
+	exitType
+	exitRuntime
+	exitFailed
+)
+
+const usage = `usage: mosalat <command> [flags] [rules file | test files]
+
+commands:
+  eval    evaluate rules and print the outputs as JSON
+  check   parse and type-check rules
+  fmt     print rules in canonical form
+  ast     print the tree of rules as JSON
+  repl    run rules and expressions interactively
+  test    run the cases of rule test files
+
+The rules file is read from stdin when it is missing or "-".
+Run mosalat <command> -h for the flags of a command.
+`
+
+// exitError is an error with the exit status it ends the command with.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+type command func(args []string, stdin io.Reader, stdout io.Writer) error
+
+var commands = map[string]command{
+	"eval":  evalCommand,
+	"check": checkCommand,
+	"fmt":   fmtCommand,
+	"ast":   astCommand,
+	"repl":  replCommand,
+	"test":  testCommand,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "mosalat: unknown command %q\n%s", args[0], usage)
+		return exitUsage
+	}
+	err := cmd(args[1:], stdin, stdout)
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	fmt.Fprintln(stderr, err)
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitUsage
+}
+
+// flags are the flags shared by the commands.
+type flags struct {
+	*flag.FlagSet
+	inputs  string
+	outputs string
+}
+
+func newFlags(name string, maps bool) *flags {
+	f := &flags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+	if maps {
+		f.StringVar(&f.inputs, "inputs", "", "JSON `file` of the inputs")
+		f.StringVar(&f.outputs, "outputs", "", "JSON `file` of the initial outputs")
+	}
+	return f
+}
+
+// maps returns the functions, the inputs and the outputs of the rules.
+func (f *flags) maps() (funcMap, inputMap, outputMap map[string]interface{}, err error) {
+	if inputMap, err = readJSONMap(f.inputs); err != nil {
+		return nil, nil, nil, err
+	}
+	if outputMap, err = readJSONMap(f.outputs); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := stdlib.Validate(inputMap, outputMap); err != nil {
+		return nil, nil, nil, err
+	}
+	return stdlib.Funcs(), inputMap, outputMap, nil
+}
+
+func readJSONMap(path string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if path == "" {
+		return m, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// ruleFile is a rule file split into its rules.
+type ruleFile struct {
+	name  string
+	lines []string
+	rules []string
+	line  []int // line of each rule, from 1
+}
+
+func readRuleFile(args []string, stdin io.Reader) (*ruleFile, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("expected one rules file, got %d", len(args))
+	}
+	f := &ruleFile{name: "<stdin>"}
+	var b []byte
+	var err error
+	if len(args) == 0 || args[0] == "-" {
+		b, err = ioutil.ReadAll(stdin)
+	} else {
+		f.name = args[0]
+		b, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.lines = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	for i, l := range f.lines {
+		l = strings.TrimSpace(strings.TrimSuffix(l, "\r"))
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		f.rules = append(f.rules, l)
+		f.line = append(f.line, i+1)
+	}
+	return f, nil
+}
+
+// parse parses the rules, without resolving names when the maps are nil.
+func (f *ruleFile) parse(funcMap, inputMap, outputMap map[string]interface{}) (parse.AST, error) {
+	var ast parse.AST
+	var err error
+	if inputMap == nil && outputMap == nil {
+		ast, err = parse.ParseSyntax(f.rules)
+	} else {
+		ast, err = parse.Parse(f.rules, funcMap, inputMap, outputMap)
+	}
+	var e *parse.Error
+	if errors.As(err, &e) {
+		return ast, &exitError{exitSyntax, fmt.Errorf("%s:%d: %v", f.name, f.lineOf(e.Index), err)}
+	}
+	if err != nil {
+		return ast, &exitError{exitSyntax, fmt.Errorf("%s: %v", f.name, err)}
+	}
+	return ast, nil
+}
+
+func (f *ruleFile) check(ast parse.AST, funcMap, inputMap, outputMap map[string]interface{}) error {
+	err := check.Check(ast, funcMap, inputMap, outputMap)
+	errs, ok := err.(check.Errors)
+	if !ok {
+		return err
+	}
+	s := make([]string, len(errs))
+	for i, e := range errs {
+		s[i] = fmt.Sprintf("%s:%d:%d: %s", f.name, f.lineOf(e.Index), e.Char, e.Msg)
+	}
+	return &exitError{exitType, errors.New(strings.Join(s, "\n"))}
+}
+
+// evalError reports the errors of rules with the lines they are on.
+func (f *ruleFile) evalError(err error) error {
+	var errs eval.RuleErrors
+	var e *eval.RuleError
+	switch {
+	case errors.As(err, &errs):
+	case errors.As(err, &e):
+		errs = eval.RuleErrors{e}
+	default:
+		return &exitError{exitRuntime, fmt.Errorf("%s: %v", f.name, err)}
+	}
+	s := make([]string, len(errs))
+	for i, e := range errs {
+		s[i] = fmt.Sprintf("%s:%d: %s", f.name, f.lineOf(e.Rule), e.Err)
+	}
+	return &exitError{exitRuntime, errors.New(strings.Join(s, "\n"))}
+}
+
+func (f *ruleFile) lineOf(rule int) int {
+	if rule < 0 || rule >= len(f.line) {
+		return 0
+	}
+	return f.line[rule]
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func evalCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	f := newFlags("eval", true)
+	strict := f.Bool("strict", false, "fail on missing inputs, outputs and keys")
+	all := f.Bool("all", false, "keep evaluating after a failing rule")
+	typeCheck := f.Bool("check", true, "type-check the rules before evaluating them")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	rf, err := readRuleFile(f.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	funcMap, inputMap, outputMap, err := f.maps()
+	if err != nil {
+		return err
+	}
+	ast, err := rf.parse(funcMap, inputMap, outputMap)
+	if err != nil {
+		return err
+	}
+	if *typeCheck {
+		if err := rf.check(ast, funcMap, inputMap, outputMap); err != nil {
+			return err
+		}
+	}
+	var opts []eval.Option
+	if *strict {
+		opts = append(opts, eval.WithStrict())
+	}
+	e, err := eval.New(funcMap, inputMap, outputMap, opts...)
+	if err != nil {
+		return err
+	}
+	if !*all {
+		outputs, err := e.Eval(ast)
+		if err != nil {
+			return rf.evalError(err)
+		}
+		return writeJSON(stdout, outputs)
+	}
+	res, err := e.EvalAll(ast)
+	if err != nil {
+		return rf.evalError(err)
+	}
+	if err := writeJSON(stdout, res.Outputs); err != nil {
+		return err
+	}
+	if err := res.Err(); err != nil {
+		return rf.evalError(err)
+	}
+	return nil
+}
+
+func checkCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	f := newFlags("check", true)
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	rf, err := readRuleFile(f.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	funcMap, inputMap, outputMap, err := f.maps()
+	if err != nil {
+		return err
+	}
+	ast, err := rf.parse(funcMap, inputMap, outputMap)
+	if err != nil {
+		return err
+	}
+	return rf.check(ast, funcMap, inputMap, outputMap)
+}
+
+func fmtCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	f := newFlags("fmt", false)
+	write := f.Bool("w", false, "write the result to the rules file instead of stdout")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	rf, err := readRuleFile(f.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	if *write && rf.name == "<stdin>" {
+		return errors.New("cannot write to stdin")
+	}
+	ast, err := rf.parse(nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	// Comments and blank lines stay where they are.
+	lines := append([]string(nil), rf.lines...)
+	for i, r := range parse.Print(ast) {
+		lines[rf.line[i]-1] = r
+	}
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	if !*write {
+		_, err := stdout.Write(buf.Bytes())
+		return err
+	}
+	// The file keeps its permissions.
+	fi, err := os.Stat(rf.name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(rf.name, buf.Bytes(), fi.Mode().Perm())
+}
+
+func astCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	f := newFlags("ast", true)
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	rf, err := readRuleFile(f.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	var ast parse.AST
+	if f.inputs == "" && f.outputs == "" {
+		// Without maps only the syntax can be checked.
+		ast, err = rf.parse(nil, nil, nil)
+	} else {
+		funcMap, inputMap, outputMap, merr := f.maps()
+		if merr != nil {
+			return merr
+		}
+		ast, err = rf.parse(funcMap, inputMap, outputMap)
+	}
+	if err != nil {
+		return err
+	}
+	b, err := serialize.SerializeASTJSON(ast)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err = stdout.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "mosalat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"in.json":  `{"total": 120, "vip": true}`,
+		"out.json": `{"discount": 0}`,
+		"len.json": `{"len": 1}`,
+	})
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.json"), filepath.Join(dir, "out.json")
+	for _, c := range []struct {
+		args  []string
+		rules string
+		code  int
+		out   string
+	}{
+		{[]string{"eval", "-inputs", in, "-outputs", out}, "total>100 | discount=10\n\nvip | discount += 5\n", exitOK, `"discount": 15`},
+		{[]string{"eval", "-inputs", in, "-outputs", out}, "total > 1 | discount = sqrt(-1)", exitRuntime, ""},
+		{[]string{"eval", "-inputs", in, "-outputs", out, "-all"}, "total > 1 | discount = sqrt(-1)\ntag = \"x\"", exitRuntime, `"tag": "x"`},
+		{[]string{"eval", "-inputs", in, "-outputs", out}, "false && total > \"a\" | discount = 1", exitType, ""},
+		{[]string{"eval", "-check=false", "-inputs", in, "-outputs", out}, "false && total > \"a\" | discount = 1", exitOK, `"discount"`},
+		{[]string{"check", "-inputs", in, "-outputs", out}, "total > 1 | discount = 1", exitOK, ""},
+		{[]string{"check", "-inputs", in, "-outputs", out}, "total > \"a\" | discount = 1", exitType, ""},
+		{[]string{"check", "-inputs", in, "-outputs", out}, "total > 1 | = 1", exitSyntax, ""},
+		{[]string{"check", "-inputs", in, "-outputs", out}, "unknown > 1 | discount = 1", exitSyntax, ""},
+		{[]string{"fmt"}, "# comment\nunknown>1 | x=max(1,2)\n", exitOK, "# comment\nunknown > 1 | x = max(1, 2)\n"},
+		{[]string{"ast"}, "x = 1", exitOK, `"type": "assignment"`},
+		{[]string{"eval", "-inputs", filepath.Join(dir, "missing.json")}, "x = 1", exitUsage, ""},
+		{[]string{"eval", "-inputs", filepath.Join(dir, "len.json")}, "x = 1", exitUsage, ""},
+		{[]string{"test", "../../ruletest/testdata/discount.json"}, "", exitOK, "ok\t"},
+		{[]string{"test", "-check=false", "../../ruletest/testdata/discount.json"}, "", exitFailed, "not a valid combination"},
+		{[]string{"test", "../../ruletest/testdata/failing.json"}, "", exitFailed, "--- FAIL: ../../ruletest/testdata/failing.json: wrong value\n    output \"discount\": got 10, want 5\n"},
+		{[]string{"test", "-cover", "listing", "../../ruletest/testdata/discount.json"}, "", exitOK, "     3 | country == \"IR\" | currency = \"IRR\"\n       | condition never false\n       |         ^ == never false\n"},
+		{[]string{"test", "-cover", "report", "../../ruletest/testdata/discount.json"}, "", exitOK, "coverage: 11 of 14 outcomes (78.6%)\n"},
+		{[]string{"nope"}, "", exitUsage, ""},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := run(c.args, strings.NewReader(c.rules), &stdout, &stderr)
+		if code != c.code {
+			t.Errorf("%v on %q: exit %d, want %d: %s", c.args, c.rules, code, c.code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), c.out) {
+			t.Errorf("%v on %q: output %q does not contain %q", c.args, c.rules, stdout.String(), c.out)
+		}
+	}
+}
+
+func TestErrorLines(t *testing.T) {
+	for _, c := range []struct {
+		args  []string
+		rules string
+		err   string
+	}{
+		{[]string{"fmt"}, "# comment\n\nx = 1\na > 1 | = 1\n", "<stdin>:4: parser:"},
+		{[]string{"check"}, "x = 1\n\nunknown > 1 | x = 2\n", "<stdin>:3: parser:"},
+		{[]string{"check"}, "x = 1\n# comment\nx > \"a\" | x = 2\n", "<stdin>:3:3: operator > not defined"},
+	} {
+		var stdout, stderr bytes.Buffer
+		run(c.args, strings.NewReader(c.rules), &stdout, &stderr)
+		if !strings.HasPrefix(stderr.String(), c.err) {
+			t.Errorf("%v on %q: error %q, want prefix %q", c.args, c.rules, stderr.String(), c.err)
+		}
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"rules": "a>1 | x=1\n"})
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules")
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"fmt", "-w", path}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a > 1 | x = 1\n" {
+		t.Errorf("fmt -w wrote %q", b)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("fmt -w changed the mode to %v", fi.Mode().Perm())
+	}
+}
+
+func TestREPL(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"in.json": `{"total": 120, "vip": true}`,
+		"rules":   "total > 100 | tag = \"big\"\n",
+	})
+	defer os.RemoveAll(dir)
+	session := strings.Join([]string{
+		"total * 2",
+		"total > 100 | discount = 10",
+		"discount + 1",
+		":trace on",
+		"vip | discount += 5",
+		":trace off",
+		":load " + filepath.Join(dir, "rules"),
+		"missing > 1",
+		":reset",
+		":outputs",
+		":nope",
+	}, "\n")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"repl", "-inputs", filepath.Join(dir, "in.json")}, strings.NewReader(session), &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit %d: %s", code, stderr.String())
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"> 240\n",
+		"> discount = 10\n",
+		"> 11\n",
+		"rule 0: condition true\nrule 0: discount = 15\ndiscount = 15\n",
+		"> tag = \"big\"\n",
+		"> error: parser:",
+		"> {}\n",
+		"> error: unknown command :nope",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("session output does not contain %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sazito/mosalat/eval"
+	"github.com/sazito/mosalat/parse"
+	"github.com/sazito/mosalat/stdlib"
+)
+
+const replHelp = `Enter a rule to run it, or an expression to print its value.
+  :inputs [file]   print the inputs, or read them from a JSON file
+  :outputs         print the outputs
+  :funcs           list the functions
+  :load file       run the rules of a file
+  :trace on|off    print conditions and assignments as rules run
+  :reset           restore the inputs and outputs the session started with
+  :help            print this help
+  :quit            leave
+`
+
+// assignment matches the start of a rule without a condition.
+var assignment = regexp.MustCompile(`^[\p{L}\p{N}_]+\s*([-+*/]?=[^=]|append\s)`)
+
+// repl is the state kept between the lines of an interactive session.
+type repl struct {
+	out       io.Writer
+	funcMap   map[string]interface{}
+	inputMap  map[string]interface{}
+	outputMap map[string]interface{}
+	trace     bool
+
+	initialInputs  map[string]interface{}
+	initialOutputs map[string]interface{}
+}
+
+func replCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	f := newFlags("repl", true)
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %q", f.Args())
+	}
+	funcMap, inputMap, outputMap, err := f.maps()
+	if err != nil {
+		return err
+	}
+	r := &repl{
+		out:            stdout,
+		funcMap:        funcMap,
+		initialInputs:  inputMap,
+		initialOutputs: outputMap,
+	}
+	r.reset()
+	fmt.Fprintln(stdout, "mosalat repl, :help for commands")
+	s := bufio.NewScanner(stdin)
+	for {
+		fmt.Fprint(stdout, "> ")
+		if !s.Scan() {
+			fmt.Fprintln(stdout)
+			return s.Err()
+		}
+		line := strings.TrimSpace(s.Text())
+		if line == ":quit" || line == ":q" {
+			return nil
+		}
+		if err := r.do(line); err != nil {
+			fmt.Fprintln(stdout, "error:", err)
+		}
+	}
+}
+
+func (r *repl) reset() {
+	r.inputMap = copyMap(r.initialInputs)
+	r.outputMap = copyMap(r.initialOutputs)
+}
+
+func (r *repl) do(line string) error {
+	switch {
+	case line == "" || strings.HasPrefix(line, "#"):
+		return nil
+	case strings.HasPrefix(line, ":"):
+		return r.command(strings.Fields(line[1:]))
+	case strings.Contains(line, " | ") || assignment.MatchString(line):
+		return r.run(&ruleFile{name: "<input>", rules: []string{line}, line: []int{1}})
+	}
+	return r.expression(line)
+}
+
+func (r *repl) command(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command, :help lists them")
+	}
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "help" && len(args) == 0:
+		fmt.Fprint(r.out, replHelp)
+	case cmd == "inputs" && len(args) == 0:
+		return writeJSON(r.out, r.inputMap)
+	case cmd == "inputs" && len(args) == 1:
+		m, err := readJSONMap(args[0])
+		if err != nil {
+			return err
+		}
+		r.inputMap = m
+	case cmd == "outputs" && len(args) == 0:
+		return writeJSON(r.out, r.outputMap)
+	case cmd == "funcs" && len(args) == 0:
+		fmt.Fprintln(r.out, strings.Join(stdlib.Names(), " "))
+	case cmd == "load" && len(args) == 1:
+		rf, err := readRuleFile(args, nil)
+		if err != nil {
+			return err
+		}
+		return r.run(rf)
+	case cmd == "trace" && len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		r.trace = args[0] == "on"
+	case cmd == "reset" && len(args) == 0:
+		r.reset()
+	default:
+		return fmt.Errorf("unknown command :%s, :help lists them", strings.Join(append([]string{cmd}, args...), " "))
+	}
+	return nil
+}
+
+// run runs rules and prints the outputs they changed.
+func (r *repl) run(rf *ruleFile) error {
+	ast, err := rf.parse(r.funcMap, r.inputMap, r.outputMap)
+	if err != nil {
+		return err
+	}
+	if err := rf.check(ast, r.funcMap, r.inputMap, r.outputMap); err != nil {
+		return err
+	}
+	var opts []eval.Option
+	if r.trace {
+		opts = append(opts, eval.WithTrace(r.out))
+	}
+	before := copyMap(r.outputMap)
+	e, err := eval.New(r.funcMap, r.inputMap, r.outputMap, opts...)
+	if err != nil {
+		return err
+	}
+	outputs, err := e.Eval(ast)
+	if err != nil {
+		return rf.evalError(err)
+	}
+	r.outputMap = outputs
+	var changed []string
+	for k, v := range outputs {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	for _, k := range changed {
+		fmt.Fprintf(r.out, "%s = %s\n", k, format(outputs[k]))
+	}
+	return nil
+}
+
+func (r *repl) expression(line string) error {
+	node, err := parse.ParseExpression(line, r.funcMap, r.inputMap, r.outputMap)
+	if err != nil {
+		return err
+	}
+	e, err := eval.New(r.funcMap, r.inputMap, r.outputMap)
+	if err != nil {
+		return err
+	}
+	v, err := e.EvalExpression(node)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.out, format(v))
+	return nil
+}
+
+// format prints a value the way it is written in JSON, or in a rule for
+// dates and durations.
+func format(v interface{}) string {
+	switch v.(type) {
+	case time.Time, time.Duration:
+		return fmt.Sprint(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
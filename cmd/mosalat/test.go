@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sazito/mosalat/eval"
+	"github.com/sazito/mosalat/parse"
+	"github.com/sazito/mosalat/ruletest"
+	"github.com/sazito/mosalat/stdlib"
+)
+
+func testCommand(args []string, stdin io.Reader, stdout io.Writer) error {
+	f := newFlags("test", false)
+	verbose := f.Bool("v", false, "print every case, not only the failing ones")
+	strict := f.Bool("strict", false, "fail on missing inputs, outputs and keys")
+	typeCheck := f.Bool("check", true, "type-check the rules before running each case")
+	cover := f.String("cover", "", "print the coverage of the rules of each file as a `report` or a source `listing`")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	if f.NArg() == 0 {
+		return errors.New("expected test files")
+	}
+	if *cover != "" && *cover != "report" && *cover != "listing" {
+		return fmt.Errorf("-cover must be report or listing, not %q", *cover)
+	}
+	var opts []eval.Option
+	if *strict {
+		opts = append(opts, eval.WithStrict())
+	}
+	if *typeCheck {
+		opts = append(opts, eval.WithTypeCheck())
+	}
+	cases, failed := 0, 0
+	for _, path := range f.Args() {
+		s, err := ruletest.Load(path)
+		if err != nil {
+			return err
+		}
+		fileFailed := 0
+		cov := eval.NewCoverage()
+		for _, r := range s.Run(stdlib.Funcs(), append(opts, eval.WithCoverage(cov))...) {
+			cases++
+			if r.Err == nil {
+				if *verbose {
+					fmt.Fprintf(stdout, "--- PASS: %s: %s\n", path, r.Name)
+				}
+				continue
+			}
+			fileFailed++
+			fmt.Fprintf(stdout, "--- FAIL: %s: %s\n", path, r.Name)
+			fmt.Fprintf(stdout, "    %s\n", strings.Replace(r.Err.Error(), "\n", "\n    ", -1))
+		}
+		if fileFailed > 0 {
+			fmt.Fprintf(stdout, "FAIL\t%s\n", path)
+		} else {
+			fmt.Fprintf(stdout, "ok\t%s\n", path)
+		}
+		failed += fileFailed
+		if *cover != "" {
+			if err := writeCoverage(stdout, *cover, cov, s.Rules); err != nil {
+				return err
+			}
+		}
+	}
+	if failed > 0 {
+		return &exitError{exitFailed, fmt.Errorf("%d of %d cases failed", failed, cases)}
+	}
+	return nil
+}
+
+func writeCoverage(w io.Writer, mode string, cov *eval.Coverage, rules []string) error {
+	ast, err := parse.ParseSyntax(rules)
+	if err != nil {
+		return &exitError{exitSyntax, err}
+	}
+	if mode == "listing" {
+		return cov.Annotate(w, rules, ast)
+	}
+	return cov.Report(w, ast)
+}
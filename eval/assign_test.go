@@ -0,0 +1,78 @@
+package eval
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompoundAssignment(t *testing.T) {
+	inputs := map[string]interface{}{"n": 4.0, "s": "a"}
+	for _, c := range []struct {
+		rules   []string
+		outputs map[string]interface{}
+		want    map[string]interface{}
+	}{
+		{[]string{"x += 2"}, nil, map[string]interface{}{"x": 2.0}},
+		{[]string{"x -= 2"}, nil, map[string]interface{}{"x": -2.0}},
+		{[]string{"x += n", "x -= 1", "x *= 3", "x /= 2"}, nil, map[string]interface{}{"x": 4.5}},
+		{[]string{"x += 1"}, map[string]interface{}{"x": nil}, map[string]interface{}{"x": 1.0}},
+		{[]string{"x *= 2"}, map[string]interface{}{"x": 5.0}, map[string]interface{}{"x": 10.0}},
+		{[]string{"x /= 4"}, map[string]interface{}{"x": 10.0}, map[string]interface{}{"x": 2.5}},
+		{[]string{"x += 1"}, map[string]interface{}{"x": 2}, map[string]interface{}{"x": 3}},
+		{[]string{"n > 1 | x += 1", "n > 9 | x += 10"}, nil, map[string]interface{}{"x": 1.0}},
+		{[]string{"x += 1h", "x += 30m"}, nil, map[string]interface{}{"x": 90 * time.Minute}},
+		// Appends start a new list on an absent output.
+		{[]string{"tags append s", "tags append n"}, nil, map[string]interface{}{"tags": []interface{}{"a", 4.0}}},
+		{[]string{"tags append s"}, map[string]interface{}{"tags": nil}, map[string]interface{}{"tags": []interface{}{"a"}}},
+		{[]string{"tags append s"}, map[string]interface{}{"tags": []string{"b"}}, map[string]interface{}{"tags": []string{"b", "a"}}},
+	} {
+		got, err := evalRules(t, c.rules, nil, inputs, c.outputs)
+		if err != nil {
+			t.Errorf("%q: %v", c.rules, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q = %#v, want %#v", c.rules, got, c.want)
+		}
+	}
+}
+
+func TestCompoundAssignmentErrors(t *testing.T) {
+	inputs := map[string]interface{}{"n": 4.0, "s": "a", "none": nil}
+	for _, c := range []struct {
+		rules   []string
+		outputs map[string]interface{}
+		err     string
+	}{
+		{[]string{"x *= 2"}, nil, `operator *= on undefined output "x" at line 0 char 1`},
+		{[]string{"x /= 2"}, nil, `operator /= on undefined output "x"`},
+		{[]string{"x *= 2"}, map[string]interface{}{"x": nil}, `operator *= on undefined output "x"`},
+		{[]string{"x += none"}, nil, "operator += with null"},
+		{[]string{"x += s"}, nil, "operator += not defined on string"},
+		{[]string{"x -= s"}, nil, "operator -= not defined on string"},
+		{[]string{"x += 1", "x += s"}, nil, "not a valid combination"},
+		{[]string{"x append 1"}, map[string]interface{}{"x": 1.0}, `cannot append to "x" of type float64`},
+		{[]string{"tags append n"}, map[string]interface{}{"tags": []string{"b"}}, `cannot append to "tags"`},
+	} {
+		_, err := evalRules(t, c.rules, nil, inputs, c.outputs)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: error %v, want %q", c.rules, err, c.err)
+		}
+	}
+}
+
+// The list of the caller is copied, not appended to in place.
+func TestAppendCopies(t *testing.T) {
+	list := make([]interface{}, 1, 4)
+	list[0] = "b"
+	outputs := map[string]interface{}{"tags": list}
+	got, err := evalRules(t, []string{"tags append s"}, nil, map[string]interface{}{"s": "a"}, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got["tags"], []interface{}{"b", "a"}) || len(list) != 1 || list[:2][1] != nil {
+		t.Errorf("tags = %v, caller's list = %v", got["tags"], list[:2])
+	}
+}
@@ -0,0 +1,134 @@
+package eval
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+var errFail = errors.New("fail")
+
+var atomicFuncs = map[string]interface{}{
+	"fail": func(n float64) (float64, error) {
+		return 0, errFail
+	},
+	"explode": func(n float64) float64 {
+		panic("explode")
+	},
+}
+
+// A failing evaluation leaves the map of the caller as it was.
+func TestCopyOnWrite(t *testing.T) {
+	outputs := map[string]interface{}{"x": 1.0, "y": 1.0}
+	got, err := evalRules(t, []string{"x = 2", "y = fail(1)"}, atomicFuncs, nil, outputs)
+	if err == nil || !errors.Is(err, errFail) {
+		t.Fatalf("error %v, want %v", err, errFail)
+	}
+	if got != nil {
+		t.Errorf("outputs = %v, want nil", got)
+	}
+	if want := map[string]interface{}{"x": 1.0, "y": 1.0}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("caller's outputs = %v, want %v", outputs, want)
+	}
+
+	// A successful one updates it.
+	if _, err := evalRules(t, []string{"x = 2", "z = 3"}, atomicFuncs, nil, outputs); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"x": 2.0, "y": 1.0, "z": 3.0}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("caller's outputs = %v, want %v", outputs, want)
+	}
+}
+
+func TestRuleAtomicity(t *testing.T) {
+	outputs := map[string]interface{}{"x": 1.0, "y": 1.0}
+	got, err := evalRules(t, []string{
+		"x = 2",
+		// Both rules fail after their first assignment, which is discarded.
+		"x = 3, y = fail(1)",
+		"y = 4, x = explode(1)",
+		"z = x + y",
+	}, atomicFuncs, nil, outputs, WithRuleAtomicity())
+	errs, ok := err.(RuleErrors)
+	if !ok {
+		t.Fatalf("error %v is not RuleErrors", err)
+	}
+	if len(errs) != 2 || errs[0].Rule != 1 || errs[1].Rule != 2 {
+		t.Fatalf("errors = %v, want rules 1 and 2", errs)
+	}
+	if !errors.Is(errs[0], errFail) {
+		t.Errorf("rule 1 error %v, want %v", errs[0], errFail)
+	}
+	if errs[1].Err.Error() != "explode" {
+		t.Errorf("rule 2 error %v, want the panic", errs[1])
+	}
+	want := map[string]interface{}{"x": 2.0, "y": 1.0, "z": 3.0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outputs = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("caller's outputs = %v, want %v", outputs, want)
+	}
+}
+
+// The assignments of a failing rule do not count for the policies either.
+func TestRuleAtomicityPolicies(t *testing.T) {
+	got, err := evalRules(t, []string{
+		"x = 1, y = fail(1)",
+		"x = 2",
+		"tags = 1, y = fail(1)",
+		"tags = 2",
+	}, atomicFuncs, nil, nil, WithRuleAtomicity(), WithPolicy("x", FirstWins), WithPolicy("tags", Collect))
+	if errs, ok := err.(RuleErrors); !ok || len(errs) != 2 {
+		t.Fatalf("error %v, want two rule errors", err)
+	}
+	want := map[string]interface{}{"x": 2.0, "tags": []interface{}{2.0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outputs = %v, want %v", got, want)
+	}
+}
+
+func TestEvalAll(t *testing.T) {
+	rules := []string{
+		"x = fail(1)",
+		"y = 2",
+		"z = explode(1)",
+		"w = y + 1",
+	}
+	ast, err := parse.Parse(rules, atomicFuncs, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(atomicFuncs, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.EvalAll(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"y": 2.0, "w": 3.0}; !reflect.DeepEqual(res.Outputs, want) {
+		t.Errorf("outputs = %v, want %v", res.Outputs, want)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Rule != 0 || res.Errors[1].Rule != 2 {
+		t.Fatalf("errors = %v, want rules 0 and 2", res.Errors)
+	}
+	if want := "rule 0: function fail: fail at line 0 char 8\nrule 2: explode"; res.Err() == nil || res.Err().Error() != want {
+		t.Errorf("Err() = %v, want %q", res.Err(), want)
+	}
+
+	// Every rule succeeds.
+	ast, err = parse.Parse([]string{"y = 2"}, atomicFuncs, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = e.EvalAll(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Errors != nil || res.Err() != nil || res.Outputs["y"] != 2.0 {
+		t.Errorf("result = %+v, want y = 2 and no errors", res)
+	}
+}
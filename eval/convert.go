@@ -0,0 +1,113 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+var (
+	floatType    = reflect.TypeOf(float64(0))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// convert converts v to t. Numbers are converted between all numeric kinds,
+// both widening and narrowing, as long as the value fits t exactly.
+func convert(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, fmt.Errorf("cannot use null as %s", t)
+	}
+	vv := reflect.ValueOf(v)
+	if vv.Type().AssignableTo(t) {
+		return vv, nil
+	}
+	// A duration is a number of nanoseconds, it only converts to durations.
+	if (vv.Type() == durationType) != (t == durationType) && (vv.Type() == durationType || t == durationType) {
+		return reflect.Value{}, fmt.Errorf("cannot convert %v (%s) to %s", v, vv.Type(), t)
+	}
+	if isNumberKind(vv.Kind()) && isNumberKind(t.Kind()) {
+		return convertNumber(vv, t)
+	}
+	if vv.Kind() == t.Kind() && (t.Kind() == reflect.String || t.Kind() == reflect.Bool) {
+		return vv.Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot convert %v (%s) to %s", v, vv.Type(), t)
+}
+
+func convertNumber(vv reflect.Value, t reflect.Type) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	switch {
+	case isIntKind(t.Kind()):
+		i, ok := toInt64(vv)
+		if !ok || out.OverflowInt(i) {
+			return reflect.Value{}, fmt.Errorf("cannot convert %v to %s without loss", vv.Interface(), t)
+		}
+		out.SetInt(i)
+	case isUintKind(t.Kind()):
+		u, ok := toUint64(vv)
+		if !ok || out.OverflowUint(u) {
+			return reflect.Value{}, fmt.Errorf("cannot convert %v to %s without loss", vv.Interface(), t)
+		}
+		out.SetUint(u)
+	default:
+		f := vv.Convert(floatType).Float()
+		if out.OverflowFloat(f) {
+			return reflect.Value{}, fmt.Errorf("cannot convert %v to %s without loss", vv.Interface(), t)
+		}
+		out.SetFloat(f)
+	}
+	return out, nil
+}
+
+func toInt64(v reflect.Value) (int64, bool) {
+	switch {
+	case isIntKind(v.Kind()):
+		return v.Int(), true
+	case isUintKind(v.Kind()):
+		return int64(v.Uint()), v.Uint() <= math.MaxInt64
+	}
+	f := v.Float()
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func toUint64(v reflect.Value) (uint64, bool) {
+	switch {
+	case isIntKind(v.Kind()):
+		return uint64(v.Int()), v.Int() >= 0
+	case isUintKind(v.Kind()):
+		return v.Uint(), true
+	}
+	f := v.Float()
+	if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+		return 0, false
+	}
+	return uint64(f), true
+}
+
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUintKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return isIntKind(k) || isUintKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
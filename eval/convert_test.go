@@ -0,0 +1,78 @@
+package eval
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvert(t *testing.T) {
+	for _, c := range []struct {
+		v    interface{}
+		to   interface{} // a value of the type to convert to
+		want interface{} // nil when the conversion fails
+	}{
+		// ints
+		{2.0, int(0), int(2)},
+		{-2.0, int64(0), int64(-2)},
+		{127.0, int8(0), int8(127)},
+		{128.0, int8(0), nil},
+		{-129.0, int8(0), nil},
+		{1.5, int(0), nil},
+		{math.NaN(), int(0), nil},
+		{math.Inf(1), int64(0), nil},
+		{1e19, int64(0), nil},
+		{uint64(math.MaxInt64), int64(0), int64(math.MaxInt64)},
+		{uint64(math.MaxInt64 + 1), int64(0), nil},
+		{int64(40000), int16(0), nil},
+		{uint8(200), int32(0), int32(200)},
+		// uints
+		{2.0, uint(0), uint(2)},
+		{255.0, uint8(0), uint8(255)},
+		{256.0, uint8(0), nil},
+		{-1.0, uint(0), nil},
+		{-1.0, uint64(0), nil},
+		{int(-1), uint32(0), nil},
+		{int64(-5), uint8(0), nil},
+		{int(7), uint16(0), uint16(7)},
+		{0.5, uint(0), nil},
+		{1.8446744073709552e19, uint64(0), nil},
+		// floats
+		{int(3), float64(0), float64(3)},
+		{uint8(3), float64(0), float64(3)},
+		{-3.5, float32(0), float32(-3.5)},
+		{1e39, float32(0), nil},
+		{float32(1.5), float64(0), float64(1.5)},
+		// durations only convert to durations
+		{time.Second, time.Duration(0), time.Second},
+		{1.0, time.Duration(0), nil},
+		{time.Second, float64(0), nil},
+		{time.Second, int64(0), nil},
+		// other kinds
+		{"a", "", "a"},
+		{true, false, true},
+		{"1", 0.0, nil},
+		{1.0, "", nil},
+		{1.0, false, nil},
+		{nil, 0.0, nil},
+		{nil, []interface{}(nil), []interface{}(nil)},
+		{[]interface{}{1.0}, []interface{}(nil), []interface{}{1.0}},
+	} {
+		typ := reflect.TypeOf(c.to)
+		got, err := convert(c.v, typ)
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("convert(%#v, %s) = %#v, want an error", c.v, typ, got.Interface())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("convert(%#v, %s): %v", c.v, typ, err)
+			continue
+		}
+		if got.Type() != typ || !reflect.DeepEqual(got.Interface(), c.want) {
+			t.Errorf("convert(%#v, %s) = %#v, want %#v", c.v, typ, got.Interface(), c.want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+// Coverage records which rules ran and which outcomes their conditions had.
+// Nodes are identified by their position, so one Coverage aggregates the
+// evaluations of many evaluators, even over rules parsed again each time.
+type Coverage struct {
+	mu       sync.Mutex
+	rules    map[int]*RuleCoverage
+	branches map[parse.Position]*BranchCoverage
+}
+
+// RuleCoverage counts the evaluations of a rule. A rule without a
+// condition counts as true.
+type RuleCoverage struct {
+	True    int
+	False   int
+	Actions int // evaluations where every action of the rule ran
+}
+
+// BranchCoverage counts the results of a comparison, && or ||.
+type BranchCoverage struct {
+	True  int
+	False int
+}
+
+// NewCoverage returns an empty coverage, shared by passing it to
+// WithCoverage.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		rules:    make(map[int]*RuleCoverage),
+		branches: make(map[parse.Position]*BranchCoverage),
+	}
+}
+
+// WithCoverage records the coverage of every evaluation in c.
+func WithCoverage(c *Coverage) Option {
+	return func(e *Evaluator) {
+		e.coverage = c
+	}
+}
+
+// Rule returns the counts of the rule at index i.
+func (c *Coverage) Rule(i int) RuleCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if r, ok := c.rules[i]; ok {
+		return *r
+	}
+	return RuleCoverage{}
+}
+
+// Branch returns the counts of a conditional expression.
+func (c *Coverage) Branch(node *parse.ConditionalExpressionNode) BranchCoverage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.branches[node.Position]; ok {
+		return *b
+	}
+	return BranchCoverage{}
+}
+
+func (c *Coverage) rule(i int) *RuleCoverage {
+	r, ok := c.rules[i]
+	if !ok {
+		r = &RuleCoverage{}
+		c.rules[i] = r
+	}
+	return r
+}
+
+func (c *Coverage) condition(rule int, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ok {
+		c.rule(rule).True++
+	} else {
+		c.rule(rule).False++
+	}
+}
+
+func (c *Coverage) actions(rule int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rule(rule).Actions++
+}
+
+func (c *Coverage) branch(node *parse.ConditionalExpressionNode, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, found := c.branches[node.Position]
+	if !found {
+		b = &BranchCoverage{}
+		c.branches[node.Position] = b
+	}
+	if ok {
+		b.True++
+	} else {
+		b.False++
+	}
+}
+
+// Report writes the counts of every rule of ast and of the conditional
+// expressions in it, followed by the share of outcomes covered. The
+// outcomes are true and false for conditions and conditional expressions,
+// and running for rules without a condition.
+func (c *Coverage) Report(w io.Writer, ast parse.AST) error {
+	covered, total := 0, 0
+	var b strings.Builder
+	for i, rule := range rules(ast) {
+		r := c.Rule(i)
+		if rule.Condition == nil {
+			fmt.Fprintf(&b, "rule %d: ran %d, actions ran %d\n", i, r.True, r.Actions)
+			covered, total = covered+min1(r.True), total+1
+		} else {
+			fmt.Fprintf(&b, "rule %d: true %d, false %d, actions ran %d\n", i, r.True, r.False, r.Actions)
+			covered, total = covered+min1(r.True)+min1(r.False), total+2
+		}
+		conditionals(&rule, func(n *parse.ConditionalExpressionNode) {
+			br := c.Branch(n)
+			fmt.Fprintf(&b, "  line %d char %d %s: true %d, false %d\n", n.Index, n.Char, n.Identifier, br.True, br.False)
+			covered, total = covered+min1(br.True)+min1(br.False), total+2
+		})
+	}
+	fmt.Fprintf(&b, "coverage: %d of %d outcomes (%s)\n", covered, total, percent(covered, total))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Annotate writes the source of the rules, as given to parse.Parse, with
+// the number of times the actions of each rule ran and, under a rule, the
+// outcomes it never had. A caret points at the operator of a conditional
+// expression.
+func (c *Coverage) Annotate(w io.Writer, src []string, ast parse.AST) error {
+	var b strings.Builder
+	for i, rule := range rules(ast) {
+		r := c.Rule(i)
+		line := ""
+		if i < len(src) {
+			line = src[i]
+		}
+		fmt.Fprintf(&b, "%6d | %s\n", r.Actions, line)
+		switch {
+		case r.True+r.False == 0:
+			fmt.Fprintf(&b, "%6s | rule never evaluated\n", "")
+			continue
+		case rule.Condition == nil:
+		case r.True == 0:
+			fmt.Fprintf(&b, "%6s | condition never true\n", "")
+		case r.False == 0:
+			fmt.Fprintf(&b, "%6s | condition never false\n", "")
+		}
+		conditionals(&rule, func(n *parse.ConditionalExpressionNode) {
+			gap := missing(c.Branch(n))
+			if gap == "" {
+				return
+			}
+			// Positions are at the end of the operator.
+			start := n.Char - len(n.Identifier)
+			if start < 0 || start > len(line) {
+				start = 0
+			}
+			fmt.Fprintf(&b, "%6s | %s^ %s %s\n", "", strings.Repeat(" ", utf8.RuneCountInString(line[:start])), n.Identifier, gap)
+		})
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func missing(b BranchCoverage) string {
+	switch {
+	case b.True+b.False == 0:
+		return "never evaluated"
+	case b.True == 0:
+		return "never true"
+	case b.False == 0:
+		return "never false"
+	}
+	return ""
+}
+
+func min1(n int) int {
+	if n > 0 {
+		return 1
+	}
+	return 0
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
+
+func rules(ast parse.AST) []parse.RuleNode {
+	switch n := ast.Node.(type) {
+	case *parse.EngineNode:
+		if n != nil {
+			return n.Rules
+		}
+	case parse.EngineNode:
+		return n.Rules
+	}
+	return nil
+}
+
+// conditionals calls f with every conditional expression of a rule, in the
+// order of their operators in the source.
+func conditionals(rule *parse.RuleNode, f func(*parse.ConditionalExpressionNode)) {
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ExpressionNode:
+			if n != nil {
+				walk(n.Expression)
+			}
+		case parse.ExpressionNode:
+			walk(n.Expression)
+		case *parse.NotNode:
+			walk(n.Expression)
+		case *parse.FunctionNode:
+			for i := range n.Args {
+				walk(&n.Args[i])
+			}
+		case *parse.MathExpressionNode:
+			walk(n.LeftExpression)
+			walk(n.RightExpression)
+		case parse.MathExpressionNode:
+			walk(n.LeftExpression)
+			walk(n.RightExpression)
+		case *parse.ConditionalExpressionNode:
+			walk(n.LeftExpression)
+			f(n)
+			walk(n.RightExpression)
+		case parse.ConditionalExpressionNode:
+			walk(n.LeftExpression)
+			f(&n)
+			walk(n.RightExpression)
+		}
+	}
+	if rule.Condition != nil {
+		walk(rule.Condition)
+	}
+	for i := range rule.Actions {
+		walk(rule.Actions[i].RightExpression)
+	}
+}
@@ -0,0 +1,173 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+var coverageRules = []string{
+	"x > 1 && y > 1 | a = 1",
+	"b = 2",
+	`name == "سلام" || x > 5 | c = 3`,
+	"x < 9 || y > 100 | d = 4",
+}
+
+// cover evaluates the rules once for every input, each time with a new
+// evaluator over rules parsed again, and returns the shared coverage.
+func cover(t *testing.T, inputs ...map[string]interface{}) (*Coverage, parse.AST) {
+	t.Helper()
+	cov := NewCoverage()
+	var ast parse.AST
+	for _, in := range inputs {
+		var err error
+		ast, err = parse.Parse(coverageRules, nil, in, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := New(nil, in, nil, WithCoverage(cov))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Eval(ast); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cov, ast
+}
+
+var coverageInputs = []map[string]interface{}{
+	{"x": 0.0, "y": 0.0, "name": ""},
+	{"x": 2.0, "y": 2.0, "name": "سلام"},
+	{"x": 2.0, "y": 0.0, "name": "x"},
+}
+
+func TestCoverage(t *testing.T) {
+	cov, ast := cover(t, coverageInputs...)
+	for i, want := range []RuleCoverage{
+		{True: 1, False: 2, Actions: 1},
+		{True: 3, Actions: 3},
+		{True: 1, False: 2, Actions: 1},
+		{True: 3, Actions: 3},
+	} {
+		if got := cov.Rule(i); got != want {
+			t.Errorf("rule %d: %+v, want %+v", i, got, want)
+		}
+	}
+
+	and := ast.Node.(*parse.EngineNode).Rules[0].Condition.Expression.(*parse.ConditionalExpressionNode)
+	for _, c := range []struct {
+		node *parse.ConditionalExpressionNode
+		want BranchCoverage
+	}{
+		{and, BranchCoverage{True: 1, False: 2}},
+		{and.LeftExpression.(*parse.ConditionalExpressionNode), BranchCoverage{True: 2, False: 1}},
+		// The right side of && is not evaluated when x > 1 is false.
+		{and.RightExpression.(*parse.ConditionalExpressionNode), BranchCoverage{True: 1, False: 1}},
+	} {
+		if got := cov.Branch(c.node); got != c.want {
+			t.Errorf("%s at char %d: %+v, want %+v", c.node.Identifier, c.node.Char, got, c.want)
+		}
+	}
+}
+
+func TestCoverageReport(t *testing.T) {
+	cov, ast := cover(t, coverageInputs...)
+	var b strings.Builder
+	if err := cov.Report(&b, ast); err != nil {
+		t.Fatal(err)
+	}
+	want := `rule 0: true 1, false 2, actions ran 1
+  line 0 char 3 >: true 2, false 1
+  line 0 char 8 &&: true 1, false 2
+  line 0 char 12 >: true 1, false 1
+rule 1: ran 3, actions ran 3
+rule 2: true 1, false 2, actions ran 1
+  line 2 char 7 ==: true 1, false 2
+  line 2 char 21 ||: true 1, false 2
+  line 2 char 25 >: true 0, false 2
+rule 3: true 3, false 0, actions ran 3
+  line 3 char 3 <: true 3, false 0
+  line 3 char 8 ||: true 3, false 0
+  line 3 char 12 >: true 0, false 0
+coverage: 19 of 25 outcomes (76.0%)
+`
+	if got := b.String(); got != want {
+		t.Errorf("report:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCoverageAnnotate(t *testing.T) {
+	cov, ast := cover(t, coverageInputs...)
+	var b strings.Builder
+	if err := cov.Annotate(&b, coverageRules, ast); err != nil {
+		t.Fatal(err)
+	}
+	// Carets count runes, not bytes, of the text before the operator.
+	want := `     1 | x > 1 && y > 1 | a = 1
+     3 | b = 2
+     1 | name == "سلام" || x > 5 | c = 3
+       |                     ^ > never true
+     3 | x < 9 || y > 100 | d = 4
+       | condition never false
+       |   ^ < never false
+       |       ^ || never false
+       |            ^ > never evaluated
+`
+	if got := b.String(); got != want {
+		t.Errorf("annotate:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCoverageNeverEvaluated(t *testing.T) {
+	ast, err := parse.ParseSyntax(coverageRules[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cov := NewCoverage()
+	var b strings.Builder
+	if err := cov.Annotate(&b, coverageRules[:2], ast); err != nil {
+		t.Fatal(err)
+	}
+	want := `     0 | x > 1 && y > 1 | a = 1
+       | rule never evaluated
+     0 | b = 2
+       | rule never evaluated
+`
+	if got := b.String(); got != want {
+		t.Errorf("annotate:\n%s\nwant:\n%s", got, want)
+	}
+	b.Reset()
+	if err := cov.Report(&b, ast); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); !strings.HasSuffix(got, "coverage: 0 of 9 outcomes (0.0%)\n") {
+		t.Errorf("report:\n%s", got)
+	}
+}
+
+// The right side of && and || is only evaluated when it decides the result,
+// so it may fail when it is not.
+func TestShortCircuit(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		want bool
+	}{
+		{"false || false", false},
+		{"false || x", true},
+		{"true && 0", false},
+		{"n != null && n + 1 > 0", false},
+		{"n == null || n > 1", true},
+		{"exists(user) && user.address.city == \"Kish\"", false},
+	} {
+		got, err := evalExpr(t, c.expr, declaredInputs, map[string]interface{}{"n": nil, "x": 2.0})
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s = %v, want %t", c.expr, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+// RuleError reports the rule an evaluation error happened in. Position is
+// the position of the rule, Err carries the position of the failing node
+// in its message.
+type RuleError struct {
+	Rule     int
+	Position parse.Position
+	Err      error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("rule %d: %s", e.Rule, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// RuleErrors holds the errors of the rules that failed when the evaluation
+// continues after a failing rule.
+type RuleErrors []*RuleError
+
+func (e RuleErrors) Error() string {
+	s := make([]string, len(e))
+	for i := range e {
+		s[i] = e[i].Error()
+	}
+	return strings.Join(s, "\n")
+}
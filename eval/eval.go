@@ -2,12 +2,15 @@ package eval
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"reflect"
 	"runtime"
 	"sync"
 
+	"github.com/sazito/mosalat/check"
 	"github.com/sazito/mosalat/parse"
+	"github.com/sazito/mosalat/persian"
 )
 
 func isTrue(val reflect.Value) (truth, ok bool) {
@@ -47,9 +50,26 @@ type stateMaps struct {
 type Evaluator struct {
 	mu    sync.Mutex
 	state stateMaps
+
+	normalizeStrings bool
+	strict           bool
+	policies         map[string]Policy
+	strictConflicts  bool
+	outputTypes      map[string]reflect.Type
+	typeChanges      bool
+	typeCheck        bool
+	ruleAtomicity    bool
+	trace            io.Writer
+	coverage         *Coverage
+
+	rule   int
+	writes map[string]write
 }
 
-func New(funcMap, inputMap, outputMap map[string]interface{}) (e *Evaluator, err error) {
+// New returns an evaluator over the given maps. Every function in funcMap
+// must return either a single value, or a value and an error; a non-nil
+// error stops the evaluation and is returned with the failing rule.
+func New(funcMap, inputMap, outputMap map[string]interface{}, opts ...Option) (e *Evaluator, err error) {
 	e = &Evaluator{
 		state: stateMaps{
 			inputMap:  inputMap,
@@ -57,51 +77,154 @@ func New(funcMap, inputMap, outputMap map[string]interface{}) (e *Evaluator, err
 			funcMap:   funcMap,
 		},
 	}
+	for _, opt := range opts {
+		opt(e)
+	}
 	return
 }
 
 func (e *Evaluator) Eval(ast parse.AST) (map[string]interface{}, error) {
+	if err := e.check(ast); err != nil {
+		return nil, err
+	}
 	return e.eval(ast.Node)
 }
 
+// check type-checks the rules over the maps and the output types of the
+// evaluator when it was made with WithTypeCheck.
+func (e *Evaluator) check(ast parse.AST) error {
+	if !e.typeCheck {
+		return nil
+	}
+	var opts []check.Option
+	for name, t := range e.outputTypes {
+		opts = append(opts, check.WithOutputType(name, t))
+	}
+	if e.typeChanges {
+		opts = append(opts, check.WithTypeChanges())
+	}
+	return check.Check(ast, e.state.funcMap, e.state.inputMap, e.state.outputMap, opts...)
+}
+
+// EvalAll evaluates every rule even when some of them fail. A failing rule,
+// including one whose function panics, is skipped with its assignments
+// discarded and reported in the result next to the outputs of the others.
+func (e *Evaluator) EvalAll(ast parse.AST) (*Result, error) {
+	if err := e.check(ast); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.writes = make(map[string]write)
+	res, err := e.evalEngine(ast.Node, true)
+	if errs, ok := err.(RuleErrors); ok {
+		return &Result{Outputs: res, Errors: errs}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Outputs: res}, nil
+}
+
+// EvalExpression evaluates a single expression, such as one returned by
+// parse.ParseExpression, over the inputs and outputs of the evaluator.
+func (e *Evaluator) EvalExpression(node parse.Node) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = panicError(r)
+		}
+	}()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.evalExpression(node)
+}
+
 func (e *Evaluator) eval(node parse.Node) (res map[string]interface{}, err error) {
 	defer func() {
-		e := recover()
-		if e != nil {
-			switch er := e.(type) {
-			case runtime.Error:
-				err = er
-			case *reflect.ValueError:
-				err = er
-			default:
-				err = fmt.Errorf(fmt.Sprint(er))
-			}
+		if r := recover(); r != nil {
+			err = panicError(r)
 		}
 	}()
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	res, err = e.evalEngine(node)
+	e.writes = make(map[string]write)
+	res, err = e.evalEngine(node, e.ruleAtomicity)
 	return
 }
 
-func (e *Evaluator) evalEngine(node parse.Node) (map[string]interface{}, error) {
+func panicError(r interface{}) error {
+	switch er := r.(type) {
+	case runtime.Error:
+		return er
+	case *reflect.ValueError:
+		return er
+	case error:
+		return er
+	}
+	return fmt.Errorf(fmt.Sprint(r))
+}
+
+// evalEngine evaluates the rules in order. When atomic is set a failing rule
+// only discards its own assignments and the next rules still run.
+func (e *Evaluator) evalEngine(node parse.Node, atomic bool) (map[string]interface{}, error) {
+	var rules []parse.RuleNode
 	switch n := node.(type) {
 	case *parse.EngineNode:
-		for _, nr := range n.Rules {
-			if err := e.evalRuleNode(&nr); err != nil {
-				return nil, err
-			}
-		}
+		rules = n.Rules
 	case parse.EngineNode:
-		for _, nr := range n.Rules {
-			if err := e.evalRuleNode(&nr); err != nil {
+		rules = n.Rules
+	default:
+		return nil, fmt.Errorf("unknown command %T", node)
+	}
+	// Rules write to a copy of the outputs, which is committed to the
+	// caller's map only when the evaluation succeeds.
+	committed := e.state.outputMap
+	e.state.outputMap = copyMap(committed)
+	defer func() { e.state.outputMap = committed }()
+	var errs RuleErrors
+	for i := range rules {
+		e.rule = i
+		var outputs map[string]interface{}
+		var writes map[string]write
+		if atomic {
+			outputs, writes = copyMap(e.state.outputMap), copyWrites(e.writes)
+		}
+		if err := e.evalRule(&rules[i], atomic); err != nil {
+			err := &RuleError{
+				Rule:     i,
+				Position: rules[i].Position,
+				Err:      err,
+			}
+			if !atomic {
 				return nil, err
 			}
+			e.state.outputMap, e.writes = outputs, writes
+			errs = append(errs, err)
 		}
-	default:
-		return nil, fmt.Errorf("unknown command %T", node)
 	}
-	return e.state.outputMap, nil
+	if committed == nil {
+		committed = make(map[string]interface{}, len(e.state.outputMap))
+	}
+	for k, v := range e.state.outputMap {
+		committed[k] = v
+	}
+	if len(errs) > 0 {
+		return committed, errs
+	}
+	return committed, nil
+}
+
+// evalRule evaluates a rule, turning a panic into the error of the rule when
+// the evaluation goes on after failing rules.
+func (e *Evaluator) evalRule(node *parse.RuleNode, atomic bool) (err error) {
+	if atomic {
+		defer func() {
+			if r := recover(); r != nil {
+				err = panicError(r)
+			}
+		}()
+	}
+	return e.evalRuleNode(node)
 }
 
 func (e *Evaluator) evalRuleNode(node *parse.RuleNode) error {
@@ -115,6 +238,10 @@ func (e *Evaluator) evalRuleNode(node *parse.RuleNode) error {
 		if err != nil {
 			return err
 		}
+		e.tracef("rule %d: condition %t", e.rule, shouldRunAction)
+	}
+	if e.coverage != nil {
+		e.coverage.condition(e.rule, shouldRunAction)
 	}
 	if shouldRunAction {
 		for _, ar := range node.Actions {
@@ -122,6 +249,9 @@ func (e *Evaluator) evalRuleNode(node *parse.RuleNode) error {
 				return err
 			}
 		}
+		if e.coverage != nil {
+			e.coverage.actions(e.rule)
+		}
 	}
 	return nil
 }
@@ -143,16 +273,113 @@ func (e *Evaluator) evalAction(node *parse.AssingmentNode) error {
 	if err != nil {
 		return err
 	}
-	if val, ok := e.state.outputMap[node.Variable.Identifier]; ok {
-		if reflect.TypeOf(val) != reflect.TypeOf(res) {
-			return fmt.Errorf("new variable type is not compatible with the old one")
+	switch node.Operator {
+	case "", "=":
+		if res, err = e.resolve(node, res); err != nil {
+			return err
+		}
+	case "append":
+		if res, err = e.evalAppend(node, res); err != nil {
+			return err
+		}
+	default:
+		if res, err = e.evalCompound(node, res); err != nil {
+			return err
 		}
 	}
+	if res, err = e.coerce(node, res); err != nil {
+		return err
+	}
 	e.state.outputMap[node.Variable.Identifier] = res
+	e.tracef("rule %d: %s = %v", e.rule, node.Variable.Identifier, res)
 
 	return nil
 }
 
+func (e *Evaluator) tracef(format string, args ...interface{}) {
+	if e.trace != nil {
+		fmt.Fprintf(e.trace, format+"\n", args...)
+	}
+}
+
+// coerce converts a value assigned to an output to the declared type of the
+// output, or else to the type of its current value. Numbers are converted
+// when no precision is lost, so 0 can be assigned to an int output.
+func (e *Evaluator) coerce(node *parse.AssingmentNode, res interface{}) (interface{}, error) {
+	name := node.Variable.Identifier
+	if e.policies[name] == Collect {
+		return res, nil
+	}
+	t, ok := e.outputTypes[name]
+	if !ok {
+		val := e.state.outputMap[name]
+		if val == nil {
+			return res, nil
+		}
+		t = reflect.TypeOf(val)
+	}
+	if reflect.TypeOf(res) == t {
+		return res, nil
+	}
+	v, err := convert(res, t)
+	switch {
+	case err == nil && res == nil:
+		return nil, nil
+	case err == nil:
+		return v.Interface(), nil
+	case e.typeChanges:
+		return res, nil
+	case res == nil:
+		return nil, fmt.Errorf("output %q of type %s cannot hold null at line %d char %d", name, t, node.Index, node.Char)
+	}
+	return nil, fmt.Errorf("output %q of type %s cannot hold %T %v at line %d char %d", name, t, res, res, node.Index, node.Char)
+}
+
+// evalCompound applies a compound assignment to the current value of the
+// output. A first += or -= on an undefined or null output starts from zero,
+// while *= and /= on it are errors.
+func (e *Evaluator) evalCompound(node *parse.AssingmentNode, res interface{}) (interface{}, error) {
+	op := node.Operator[:1]
+	old := e.state.outputMap[node.Variable.Identifier]
+	if res == nil {
+		return nil, fmt.Errorf("operator %s with null at line %d char %d", node.Operator, node.Index, node.Char)
+	}
+	if old == nil {
+		// Only numbers and durations have a zero to start from.
+		if _, ok := toFloat(res); !ok && reflect.TypeOf(res) != durationType {
+			return nil, fmt.Errorf("operator %s not defined on %T at line %d char %d", node.Operator, res, node.Index, node.Char)
+		}
+		switch op {
+		case "+":
+			return res, nil
+		case "-":
+			return evalMath("*", res, float64(-1))
+		}
+		return nil, fmt.Errorf("operator %s on undefined output %q at line %d char %d", node.Operator, node.Variable.Identifier, node.Index, node.Char)
+	}
+	return evalMath(op, old, res)
+}
+
+// evalAppend appends to the list of the output, an undefined or null output
+// starts a new list. The list of the caller is never modified in place.
+func (e *Evaluator) evalAppend(node *parse.AssingmentNode, res interface{}) (interface{}, error) {
+	old := e.state.outputMap[node.Variable.Identifier]
+	if old == nil {
+		return []interface{}{res}, nil
+	}
+	lv := reflect.ValueOf(old)
+	if lv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("cannot append to %q of type %T at line %d char %d", node.Variable.Identifier, old, node.Index, node.Char)
+	}
+	v, err := convert(res, lv.Type().Elem())
+	if err != nil {
+		return nil, fmt.Errorf("cannot append to %q: %s at line %d char %d", node.Variable.Identifier, err, node.Index, node.Char)
+	}
+	list := reflect.MakeSlice(lv.Type(), lv.Len(), lv.Len()+1)
+	reflect.Copy(list, lv)
+	return reflect.Append(list, v).Interface(), nil
+}
+
 func (e *Evaluator) evalExpression(node parse.Node) (interface{}, error) {
 	switch n := node.(type) {
 	case *parse.ExpressionNode:
@@ -171,6 +398,20 @@ func (e *Evaluator) evalExpression(node parse.Node) (interface{}, error) {
 		return e.evalBool(n)
 	case parse.BoolNode:
 		return e.evalBool(&n)
+	case *parse.DurationNode:
+		return n.Duration, nil
+	case parse.DurationNode:
+		return n.Duration, nil
+	case *parse.DateNode:
+		return n.Time, nil
+	case parse.DateNode:
+		return n.Time, nil
+	case *parse.NullNode, parse.NullNode:
+		return nil, nil
+	case *parse.ExistsNode:
+		return e.evalExists(n)
+	case parse.ExistsNode:
+		return e.evalExists(&n)
 	case *parse.NotNode:
 		return e.evalNot(n)
 	case parse.NotNode:
@@ -229,44 +470,214 @@ func (e *Evaluator) evalNot(node *parse.NotNode) (bool, error) {
 }
 
 func (e *Evaluator) evalIdentifier(node *parse.IdentifierNode) (interface{}, error) {
+	v, ok, err := e.lookup(node)
+	if err != nil {
+		return nil, err
+	}
+	if !ok && e.strict {
+		return nil, fmt.Errorf("missing %s at line %d char %d", identifierText(node), node.Index, node.Char)
+	}
+	return v, nil
+}
+
+// lookup resolves an identifier and its path, it reports false when the
+// identifier or a key of its path is missing. A selector that is not
+// optional fails on a null value.
+func (e *Evaluator) lookup(node *parse.IdentifierNode) (interface{}, bool, error) {
+	m := e.state.outputMap
 	if node.IsInput {
-		return e.state.inputMap[node.Identifier], nil
+		m = e.state.inputMap
+	}
+	v, ok := m[node.Identifier]
+	if !ok {
+		return nil, false, nil
+	}
+	for _, sel := range node.Path {
+		if v == nil {
+			if sel.Optional {
+				return nil, true, nil
+			}
+			return nil, false, fmt.Errorf("cannot read %s of null at line %d char %d", identifierText(node), node.Index, node.Char)
+		}
+		if v, ok = selectKey(v, sel.Name); !ok {
+			return nil, sel.Optional, nil
+		}
+	}
+	return v, true, nil
+}
+
+// selectKey returns the value of a string key of a map or an exported field
+// of a struct.
+func selectKey(v interface{}, name string) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		mv := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !mv.IsValid() {
+			return nil, false
+		}
+		return mv.Interface(), true
+	case reflect.Struct:
+		f := rv.FieldByName(name)
+		if !f.IsValid() || !f.CanInterface() {
+			return nil, false
+		}
+		return f.Interface(), true
+	}
+	return nil, false
+}
+
+func identifierText(node *parse.IdentifierNode) string {
+	s := node.Identifier
+	for _, sel := range node.Path {
+		s += sel.String()
+	}
+	return s
+}
+
+func (e *Evaluator) evalExists(node *parse.ExistsNode) (bool, error) {
+	v, ok, err := e.lookup(node.Identifier)
+	return err == nil && ok && v != nil, nil
+}
+
+// evalCoalesce evaluates x ?? y. A missing identifier on the left is null
+// even in strict mode, so ?? gives a default to it.
+func (e *Evaluator) evalCoalesce(node *parse.MathExpressionNode) (interface{}, error) {
+	var l interface{}
+	var err error
+	if id := leftIdentifier(node.LeftExpression); id != nil {
+		l, _, err = e.lookup(id)
+	} else {
+		l, err = e.evalExpression(node.LeftExpression)
+	}
+	if err != nil || l != nil {
+		return l, err
+	}
+	return e.evalExpression(node.RightExpression)
+}
+
+// leftIdentifier returns the identifier n is, with or without parentheses,
+// nil if it is another expression.
+func leftIdentifier(n parse.Node) *parse.IdentifierNode {
+	for {
+		switch u := n.(type) {
+		case *parse.ExpressionNode:
+			n = u.Expression
+		case parse.ExpressionNode:
+			n = u.Expression
+		case *parse.IdentifierNode:
+			return u
+		case parse.IdentifierNode:
+			return &u
+		default:
+			return nil
+		}
 	}
-	return e.state.outputMap[node.Identifier], nil
 }
 
 func (e *Evaluator) evalFunction(node *parse.FunctionNode) (interface{}, error) {
-	f := reflect.ValueOf(e.state.funcMap[node.Function])
-	if !f.IsValid() {
-		return nil, fmt.Errorf("not a valid function")
-	}
-	switch f.Kind() {
-	case reflect.Func:
-		var in []reflect.Value
-		for _, n := range node.Args {
-			if r, err := e.evalExpression(n.Expression); err == nil {
-				in = append(in, reflect.ValueOf(r))
-			} else {
-				return nil, err
+	fn := e.state.funcMap[node.Function]
+	// The functions can differ from the ones the rules were parsed with.
+	if err := parse.CheckCall(node.Function, fn, len(node.Args)); err != nil {
+		return nil, fmt.Errorf("%w at line %d char %d", err, node.Index, node.Char)
+	}
+	f := reflect.ValueOf(fn)
+	in, err := e.evalArgs(node, f.Type())
+	if err != nil {
+		return nil, err
+	}
+	out := f.Call(in)
+	if len(out) == 2 {
+		if err, _ := out[1].Interface().(error); err != nil {
+			return nil, fmt.Errorf("function %s: %w at line %d char %d", node.Function, err, node.Index, node.Char)
+		}
+	}
+	return out[0].Interface(), nil
+}
+
+// evalArgs evaluates the arguments of a call and converts them to the
+// parameter types of ft. A list passed as the last argument of a variadic
+// function is spread over the variadic parameter.
+func (e *Evaluator) evalArgs(node *parse.FunctionNode, ft reflect.Type) ([]reflect.Value, error) {
+	n := ft.NumIn()
+	var in []reflect.Value
+	for i, arg := range node.Args {
+		r, err := e.evalExpression(arg.Expression)
+		if err != nil {
+			return nil, err
+		}
+		pt := ft.In(n - 1)
+		switch {
+		case i < n-1 || !ft.IsVariadic():
+			pt = ft.In(i)
+		case i == n-1 && len(node.Args) == n && isSpreadable(r, pt):
+			rv := reflect.ValueOf(r)
+			for j := 0; j < rv.Len(); j++ {
+				v, err := convert(rv.Index(j).Interface(), pt.Elem())
+				if err != nil {
+					return nil, fmt.Errorf("function %s: argument %d: element %d: %s at line %d char %d", node.Function, i+1, j, err, node.Index, node.Char)
+				}
+				in = append(in, v)
 			}
+			continue
+		default:
+			pt = pt.Elem()
 		}
-		return f.Call(in)[0].Interface(), nil
-	default:
-		return nil, fmt.Errorf("not a valid function")
+		v, err := convert(r, pt)
+		if err != nil {
+			return nil, fmt.Errorf("function %s: argument %d: %s at line %d char %d", node.Function, i+1, err, node.Index, node.Char)
+		}
+		in = append(in, v)
 	}
-	return nil, fmt.Errorf("not a valid function")
+	return in, nil
+}
+
+// isSpreadable reports whether v is a list that should be spread over the
+// variadic parameter of type t instead of being passed as one element.
+func isSpreadable(v interface{}, t reflect.Type) bool {
+	if v == nil {
+		return false
+	}
+	vt := reflect.TypeOf(v)
+	if vt.Kind() != reflect.Slice && vt.Kind() != reflect.Array {
+		return false
+	}
+	return !vt.AssignableTo(t.Elem())
 }
 
 func (e *Evaluator) evalMathExpression(node *parse.MathExpressionNode) (interface{}, error) {
+	if node.IsCoalesce {
+		return e.evalCoalesce(node)
+	}
 	l, err := e.evalExpression(node.LeftExpression)
 	if err != nil {
 		return nil, err
 	}
-	lv := reflect.ValueOf(l)
 	r, err := e.evalExpression(node.RightExpression)
 	if err != nil {
 		return nil, err
 	}
+	if l == nil || r == nil {
+		return nil, fmt.Errorf("operator %s on null at line %d char %d", node.Identifier, node.Index, node.Char)
+	}
+	return evalMath(node.Identifier, l, r)
+}
+
+// evalMath applies an arithmetic operator to two values that are not null.
+func evalMath(op string, l, r interface{}) (interface{}, error) {
+	if isTimeValue(l) || isTimeValue(r) {
+		return evalTimeMath(op, l, r)
+	}
+	lv := reflect.ValueOf(l)
 	rv := reflect.ValueOf(r)
 	var rvc, lvc reflect.Value
 	// if rv.Type().ConvertibleTo(lv.Type()) {
@@ -282,7 +693,7 @@ func (e *Evaluator) evalMathExpression(node *parse.MathExpressionNode) (interfac
 	} else {
 		return nil, fmt.Errorf("not a valid combination")
 	}
-	switch node.Identifier {
+	switch op {
 	case "+":
 		switch lvc.Kind() {
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
@@ -342,17 +753,44 @@ func (e *Evaluator) evalMathExpression(node *parse.MathExpressionNode) (interfac
 	return false, fmt.Errorf("not a valid operator")
 }
 
-func (e *Evaluator) evalConditionalExpression(node *parse.ConditionalExpressionNode) (bool, error) {
+func (e *Evaluator) equal(l, r interface{}) bool {
+	if e.normalizeStrings {
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if lok && rok {
+			return persian.Normalize(ls) == persian.Normalize(rs)
+		}
+	}
+	return reflect.DeepEqual(l, r)
+}
+
+func (e *Evaluator) evalConditionalExpression(node *parse.ConditionalExpressionNode) (res bool, err error) {
+	if e.coverage != nil {
+		defer func() {
+			if err == nil {
+				e.coverage.branch(node, res)
+			}
+		}()
+	}
 	l, err := e.evalExpression(node.LeftExpression)
 	if err != nil {
 		return false, err
 	}
 	lv := reflect.ValueOf(l)
+	if node.Identifier == "&&" || node.Identifier == "||" {
+		return e.evalLogical(node, lv)
+	}
 	r, err := e.evalExpression(node.RightExpression)
 	if err != nil {
 		return false, err
 	}
 	rv := reflect.ValueOf(r)
+	if (l == nil || r == nil) && node.IsDiffBase && node.Identifier != "==" && node.Identifier != "!=" {
+		return false, fmt.Errorf("operator %s on null at line %d char %d", node.Identifier, node.Index, node.Char)
+	}
+	if (isTimeValue(l) || isTimeValue(r)) && node.IsDiffBase {
+		return evalTimeCompare(node.Identifier, l, r)
+	}
 	switch node.Identifier {
 	case ">":
 		var rvc, lvc reflect.Value
@@ -411,31 +849,31 @@ func (e *Evaluator) evalConditionalExpression(node *parse.ConditionalExpressionN
 			return false, fmt.Errorf("not a valid combination")
 		}
 	case "==":
-		return reflect.DeepEqual(l, r), nil
+		return e.equal(l, r), nil
 	case "!=":
-		return !reflect.DeepEqual(l, r), nil
-	case "||":
-		if la, lok := isTrue(lv); lok {
-			if la {
-				return la, nil
-			}
-			if ra, rok := isTrue(rv); rok {
-				if ra {
-					return ra, nil
-				}
-			}
-		}
+		return !e.equal(l, r), nil
+	}
+	return false, fmt.Errorf("not a valid operator")
+}
+
+// evalLogical evaluates && and ||. The right operand is evaluated only when
+// the left one does not decide the result, so it is never evaluated, nor
+// counted by the coverage, after a false && or a true ||.
+func (e *Evaluator) evalLogical(node *parse.ConditionalExpressionNode, lv reflect.Value) (bool, error) {
+	la, ok := isTrue(lv)
+	if !ok {
 		return false, fmt.Errorf("not a valid conditions")
-	case "&&":
-		if la, lok := isTrue(lv); lok {
-			if !la {
-				return la, nil
-			}
-			if ra, rok := isTrue(rv); rok {
-				return ra, nil
-			}
-		}
+	}
+	if la == (node.Identifier == "||") {
+		return la, nil
+	}
+	r, err := e.evalExpression(node.RightExpression)
+	if err != nil {
+		return false, err
+	}
+	ra, ok := isTrue(reflect.ValueOf(r))
+	if !ok {
 		return false, fmt.Errorf("not a valid conditions")
 	}
-	return false, fmt.Errorf("not a valid operator")
+	return ra, nil
 }
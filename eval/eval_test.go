@@ -0,0 +1,47 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/sazito/mosalat/check"
+	"github.com/sazito/mosalat/parse"
+)
+
+// evalRules parses rules over the maps and evaluates them with opts.
+func evalRules(t *testing.T, rules []string, funcMap, inputMap, outputMap map[string]interface{}, opts ...Option) (map[string]interface{}, error) {
+	t.Helper()
+	ast, err := parse.Parse(rules, funcMap, inputMap, outputMap)
+	if err != nil {
+		t.Fatalf("%q: %v", rules, err)
+	}
+	e, err := New(funcMap, inputMap, outputMap, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.Eval(ast)
+}
+
+func TestTypeCheck(t *testing.T) {
+	rules := []string{`total > 100 | label = 1`}
+	inputs := map[string]interface{}{"total": 2.0}
+	outputs := map[string]interface{}{"label": ""}
+	if _, err := evalRules(t, rules, nil, inputs, outputs); err != nil {
+		t.Errorf("without WithTypeCheck: %v", err)
+	}
+	_, err := evalRules(t, rules, nil, inputs, outputs, WithTypeCheck())
+	if _, ok := err.(check.Errors); !ok {
+		t.Errorf("error %v, want check.Errors", err)
+	}
+
+	ast, err := parse.Parse(rules, nil, inputs, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(nil, inputs, outputs, WithTypeCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := e.EvalAll(ast); err == nil || res != nil {
+		t.Errorf("EvalAll = %v, %v, want a type error", res, err)
+	}
+}
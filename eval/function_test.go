@@ -0,0 +1,111 @@
+package eval
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+var errBoom = errors.New("boom")
+
+var funcs = map[string]interface{}{
+	"double": func(n float64) float64 { return n * 2 },
+	"sum": func(n ...float64) float64 {
+		s := 0.0
+		for _, v := range n {
+			s += v
+		}
+		return s
+	},
+	"join": func(sep string, s ...string) string { return strings.Join(s, sep) },
+	"check": func(n float64) (float64, error) {
+		if n < 0 {
+			return 0, errBoom
+		}
+		return n, nil
+	},
+	"small": func(n int8) int8 { return n },
+}
+
+var funcInputs = map[string]interface{}{
+	"n":     2.0,
+	"big":   300.0,
+	"s":     "x",
+	"nums":  []interface{}{1.0, 2.0, 3.0},
+	"words": []string{"a", "b"},
+}
+
+func TestFunctions(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		want interface{}
+		err  string
+	}{
+		{expr: "double(n)", want: 4.0},
+		{expr: "sum()", want: 0.0},
+		{expr: "sum(1, n, 3)", want: 6.0},
+		{expr: "sum(nums)", want: 6.0},
+		{expr: "join(\"-\", words)", want: "a-b"},
+		{expr: "join(\"-\", s, s)", want: "x-x"},
+		{expr: "check(n)", want: 2.0},
+		{expr: "check(-1)", err: "function check: boom"},
+		{expr: "double(s)", err: "function double: argument 1"},
+		{expr: "small(big)", err: "function small: argument 1"},
+		{expr: "sum(1, s)", err: "function sum: argument 2"},
+	} {
+		node, err := parse.ParseExpression(c.expr, funcs, funcInputs, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		e, err := New(funcs, funcInputs, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := e.EvalExpression(node)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error %v, want %q", c.expr, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %#v, want %#v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestFunctionErrorUnwraps(t *testing.T) {
+	_, err := evalRules(t, []string{"n > 0 | x = check(-1)"}, funcs, funcInputs, map[string]interface{}{"x": 0.0})
+	if !errors.Is(err, errBoom) {
+		t.Errorf("error %v does not wrap the error of the function", err)
+	}
+}
+
+// The evaluator checks calls against its own functions, which can differ
+// from the ones the rules were parsed with.
+func TestFunctionsChanged(t *testing.T) {
+	ast, err := parse.Parse([]string{"x = double(n)"}, funcs, funcInputs, map[string]interface{}{"x": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want, f := range map[string]interface{}{
+		"function double expects func(float64, float64) float64, called with 1 arguments": func(a, b float64) float64 { return a },
+		"function double func(float64) must return a value, or a value and an error":      func(a float64) {},
+		"double is not a function": 2.0,
+	} {
+		e, err := New(map[string]interface{}{"double": f}, funcInputs, map[string]interface{}{"x": 0.0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Eval(ast); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v, want %q", err, want)
+		}
+	}
+}
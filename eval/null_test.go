@@ -0,0 +1,129 @@
+package eval
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+// evalExpr parses expr over the maps the rules are written against and
+// evaluates it over inputMap, which can miss some of them.
+func evalExpr(t *testing.T, expr string, declared, inputMap map[string]interface{}, opts ...Option) (interface{}, error) {
+	t.Helper()
+	node, err := parse.ParseExpression(expr, nil, declared, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", expr, err)
+	}
+	e, err := New(nil, inputMap, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.EvalExpression(node)
+}
+
+var nullInputs = map[string]interface{}{
+	"n":    nil,
+	"x":    2.0,
+	"user": map[string]interface{}{"address": nil, "plan": "gold", "limits": map[string]interface{}{"cart": 5.0}},
+}
+
+var declaredInputs = map[string]interface{}{
+	"n":       nil,
+	"x":       0.0,
+	"user":    nil,
+	"missing": 0.0,
+}
+
+func TestNull(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		want interface{}
+		err  string
+	}{
+		{expr: "null", want: nil},
+		{expr: "n", want: nil},
+		{expr: "n == null", want: true},
+		{expr: "x != null", want: true},
+		{expr: "missing", want: nil},
+		{expr: "exists(x)", want: true},
+		{expr: "exists(n)", want: false},
+		{expr: "exists(missing)", want: false},
+		{expr: "exists(user.plan)", want: true},
+		{expr: "exists(user.address)", want: false},
+		{expr: "exists(user.address.city)", want: false},
+		{expr: "exists(user.address?.city)", want: false},
+		{expr: "user.plan", want: "gold"},
+		{expr: "user.limits.cart", want: 5.0},
+		{expr: "user.nope", want: nil},
+		{expr: "user.address?.city", want: nil},
+		{expr: "user.address.city", err: "cannot read user.address.city of null"},
+		{expr: "n + 1", err: "operator + on null"},
+		{expr: "n ?? 3", want: 3.0},
+		{expr: "x ?? 3", want: 2.0},
+		{expr: "missing ?? 3", want: 3.0},
+		{expr: "user.address?.city ?? \"none\"", want: "none"},
+		{expr: "user.plan ?? \"none\"", want: "gold"},
+		{expr: "n ?? missing ?? 4", want: 4.0},
+		// ?? binds looser than every other operator.
+		{expr: "n ?? 1 + 2", want: 3.0},
+		{expr: "x ?? 1 + 2", want: 2.0},
+		{expr: "(n ?? 1) + 2", want: 3.0},
+		{expr: "n ?? 1 > 0", want: true},
+		{expr: "x > 1 ?? false", want: true},
+	} {
+		got, err := evalExpr(t, c.expr, declaredInputs, nullInputs)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error %v, want %q", c.expr, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %#v, want %#v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		want interface{}
+		err  string
+	}{
+		{expr: "missing", err: "missing missing"},
+		{expr: "missing + 1", err: "missing missing"},
+		{expr: "user.nope", err: "missing user.nope"},
+		{expr: "user?.nope", want: nil},
+		{expr: "n", want: nil},
+		{expr: "exists(missing)", want: false},
+		{expr: "user.address?.city", want: nil},
+		// The left of ?? is never missing.
+		{expr: "missing ?? 3", want: 3.0},
+		{expr: "(missing) ?? 3", want: 3.0},
+		{expr: "user.nope ?? 3", want: 3.0},
+		{expr: "missing ?? n ?? 4", want: 4.0},
+		{expr: "x ?? missing", want: 2.0},
+		{expr: "n ?? missing", err: "missing missing"},
+	} {
+		got, err := evalExpr(t, c.expr, declaredInputs, nullInputs, WithStrict())
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error %v, want %q", c.expr, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %#v, want %#v", c.expr, got, c.want)
+		}
+	}
+}
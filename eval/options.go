@@ -0,0 +1,93 @@
+package eval
+
+import (
+	"io"
+	"reflect"
+)
+
+// Option configures an Evaluator.
+type Option func(*Evaluator)
+
+// WithNormalizedStrings makes == and != compare strings after normalizing
+// their Arabic and Persian letters and digits, so "كيك" equals "کیک".
+func WithNormalizedStrings() Option {
+	return func(e *Evaluator) {
+		e.normalizeStrings = true
+	}
+}
+
+// WithStrict makes reading a missing input, output or key of a path an
+// error, instead of null. Optional selectors ('?.'), exists(x) and a name
+// on the left of ?? still yield null and false.
+func WithStrict() Option {
+	return func(e *Evaluator) {
+		e.strict = true
+	}
+}
+
+// WithPolicy sets the policy of an output assigned by several rules, the
+// default policy is LastWins. Compound assignments and appends are not
+// affected by policies.
+func WithPolicy(output string, policy Policy) Option {
+	return func(e *Evaluator) {
+		if e.policies == nil {
+			e.policies = make(map[string]Policy)
+		}
+		e.policies[output] = policy
+	}
+}
+
+// WithStrictConflicts makes two rules assigning different values to the
+// same output a *ConflictError naming both rules. It applies to outputs
+// with the LastWins and FirstWins policies, the other policies combine the
+// values.
+func WithStrictConflicts() Option {
+	return func(e *Evaluator) {
+		e.strictConflicts = true
+	}
+}
+
+// WithOutputType declares the type of an output, values assigned to it are
+// converted to t. Outputs without a declared type keep the type of their
+// current value.
+func WithOutputType(output string, t reflect.Type) Option {
+	return func(e *Evaluator) {
+		if e.outputTypes == nil {
+			e.outputTypes = make(map[string]reflect.Type)
+		}
+		e.outputTypes[output] = t
+	}
+}
+
+// WithTypeChanges lets an assignment change the type of an output when its
+// value cannot be converted, instead of failing.
+func WithTypeChanges() Option {
+	return func(e *Evaluator) {
+		e.typeChanges = true
+	}
+}
+
+// WithTypeCheck type-checks the rules with check.Check before every
+// evaluation, so a type error is returned before any rule runs.
+func WithTypeCheck() Option {
+	return func(e *Evaluator) {
+		e.typeCheck = true
+	}
+}
+
+// WithRuleAtomicity discards the assignments of a failing rule and goes on
+// with the next rules. Eval then returns the outputs of the other rules along
+// with a RuleErrors.
+func WithRuleAtomicity() Option {
+	return func(e *Evaluator) {
+		e.ruleAtomicity = true
+	}
+}
+
+// WithTrace writes a line to w for every condition evaluated, with its
+// result, and for every assignment, with the new value of the output.
+func WithTrace(w io.Writer) Option {
+	return func(e *Evaluator) {
+		e.trace = w
+	}
+}
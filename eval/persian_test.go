@@ -0,0 +1,54 @@
+package eval
+
+import "testing"
+
+func TestPersianDigits(t *testing.T) {
+	inputs := map[string]interface{}{"n": 1000.0}
+	for _, expr := range []string{
+		"۱۰۰۰ == 1000",
+		"١٠٠٠ == 1000",
+		"n == ۱۰۰۰",
+		"۱.۵ + ٢ == 3.5",
+		"n > ۹۹۹",
+	} {
+		got, err := evalExpr(t, expr, inputs, inputs)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if got != true {
+			t.Errorf("%s = %v, want true", expr, got)
+		}
+	}
+}
+
+func TestNormalizedStrings(t *testing.T) {
+	inputs := map[string]interface{}{"name": "علي", "city": "كرج"}
+	for _, c := range []struct {
+		expr              string
+		plain, normalized bool
+	}{
+		{`"كيك" == "کیک"`, false, true},
+		{`"كيك" != "کیک"`, true, false},
+		{`name == "علی"`, false, true},
+		{`city == "کرج"`, false, true},
+		{`"پلاک ۱۲" == "پلاك 12"`, false, true},
+		{`name == "رضا"`, false, false},
+	} {
+		for _, normalize := range []bool{false, true} {
+			var opts []Option
+			want := c.plain
+			if normalize {
+				opts, want = []Option{WithNormalizedStrings()}, c.normalized
+			}
+			got, err := evalExpr(t, c.expr, inputs, inputs, opts...)
+			if err != nil {
+				t.Errorf("%s: %v", c.expr, err)
+				continue
+			}
+			if got != want {
+				t.Errorf("%s with normalizing %t = %v, want %v", c.expr, normalize, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+// Policy decides the value of an output that several matching rules assign
+// in one evaluation.
+type Policy int
+
+const (
+	LastWins  Policy = iota // the last assignment wins
+	FirstWins               // later assignments are ignored
+	Max                     // the largest value wins
+	Min                     // the smallest value wins
+	Sum                     // the values are added up
+	Collect                 // the values are collected into a []interface{}
+)
+
+func (p Policy) String() string {
+	switch p {
+	case FirstWins:
+		return "first-wins"
+	case Max:
+		return "max"
+	case Min:
+		return "min"
+	case Sum:
+		return "sum"
+	case Collect:
+		return "collect"
+	}
+	return "last-wins"
+}
+
+// write is the first assignment of an output in an evaluation.
+type write struct {
+	rule     int
+	position parse.Position
+	value    interface{}
+}
+
+func copyWrites(m map[string]write) map[string]write {
+	c := make(map[string]write, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// ConflictError reports two rules assigning different values to the same
+// output.
+type ConflictError struct {
+	Output         string
+	FirstRule      int
+	FirstPosition  parse.Position
+	FirstValue     interface{}
+	SecondRule     int
+	SecondPosition parse.Position
+	SecondValue    interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("output %q assigned %v by rule %d at line %d char %d and %v by rule %d at line %d char %d",
+		e.Output, e.FirstValue, e.FirstRule, e.FirstPosition.Index, e.FirstPosition.Char,
+		e.SecondValue, e.SecondRule, e.SecondPosition.Index, e.SecondPosition.Char)
+}
+
+// resolve merges the value assigned to an output with the values assigned
+// before in the same evaluation according to the policy of the output.
+func (e *Evaluator) resolve(node *parse.AssingmentNode, res interface{}) (interface{}, error) {
+	name := node.Variable.Identifier
+	policy := e.policies[name]
+	w, ok := e.writes[name]
+	if !ok {
+		e.writes[name] = write{
+			rule:     e.rule,
+			position: node.Position,
+			value:    res,
+		}
+		if policy == Collect {
+			return []interface{}{res}, nil
+		}
+		return res, nil
+	}
+	// Other policies combine the values, so they never conflict.
+	strict := e.strictConflicts && (policy == LastWins || policy == FirstWins)
+	if strict && w.rule != e.rule && !reflect.DeepEqual(w.value, res) {
+		return nil, &ConflictError{
+			Output:         name,
+			FirstRule:      w.rule,
+			FirstPosition:  w.position,
+			FirstValue:     w.value,
+			SecondRule:     e.rule,
+			SecondPosition: node.Position,
+			SecondValue:    res,
+		}
+	}
+	cur := e.state.outputMap[name]
+	switch policy {
+	case FirstWins:
+		return cur, nil
+	case Max, Min:
+		if res == nil || cur == nil {
+			return nil, fmt.Errorf("%s of %q with null at line %d char %d", policy, name, node.Index, node.Char)
+		}
+		greater, err := evalGreater(res, cur)
+		if err != nil {
+			return nil, err
+		}
+		if greater == (policy == Max) {
+			return res, nil
+		}
+		return cur, nil
+	case Sum:
+		if res == nil || cur == nil {
+			return nil, fmt.Errorf("%s of %q with null at line %d char %d", policy, name, node.Index, node.Char)
+		}
+		return evalMath("+", cur, res)
+	case Collect:
+		list, _ := cur.([]interface{})
+		return append(list[:len(list):len(list)], res), nil
+	}
+	return res, nil
+}
+
+// evalGreater reports whether l is greater than r, for numbers, dates and
+// durations.
+func evalGreater(l, r interface{}) (bool, error) {
+	if isTimeValue(l) || isTimeValue(r) {
+		return evalTimeCompare(">", l, r)
+	}
+	lf, lok := toFloat(l)
+	rf, rok := toFloat(r)
+	if !lok || !rok {
+		return false, fmt.Errorf("cannot compare %T and %T", l, r)
+	}
+	return lf > rf, nil
+}
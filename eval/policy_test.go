@@ -0,0 +1,59 @@
+package eval
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPolicies(t *testing.T) {
+	rules := []string{"x = 1", "x = 2", "y = 1", "y = 1"}
+	for _, c := range []struct {
+		policy   Policy
+		want     interface{}
+		conflict bool // with WithStrictConflicts
+	}{
+		{LastWins, 2.0, true},
+		{FirstWins, 1.0, true},
+		{Max, 2.0, false},
+		{Min, 1.0, false},
+		{Sum, 3.0, false},
+		{Collect, []interface{}{1.0, 2.0}, false},
+	} {
+		for _, strict := range []bool{false, true} {
+			opts := []Option{WithPolicy("x", c.policy)}
+			if strict {
+				opts = append(opts, WithStrictConflicts())
+			}
+			res, err := evalRules(t, rules, nil, nil, map[string]interface{}{"x": 0.0}, opts...)
+			if strict && c.conflict {
+				var ce *ConflictError
+				if !errors.As(err, &ce) {
+					t.Errorf("%s, strict: error %v, want a conflict", c.policy, err)
+				} else if ce.Output != "x" || ce.FirstRule != 0 || ce.SecondRule != 1 {
+					t.Errorf("%s, strict: conflict %+v", c.policy, ce)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s, strict %t: %v", c.policy, strict, err)
+				continue
+			}
+			if !reflect.DeepEqual(res["x"], c.want) {
+				t.Errorf("%s, strict %t: x = %v, want %v", c.policy, strict, res["x"], c.want)
+			}
+			// Equal values never conflict.
+			if res["y"] != 1.0 {
+				t.Errorf("%s, strict %t: y = %v, want 1", c.policy, strict, res["y"])
+			}
+		}
+	}
+}
+
+func TestPolicyNull(t *testing.T) {
+	for _, p := range []Policy{Max, Min, Sum} {
+		if _, err := evalRules(t, []string{"x = 1", "x = null"}, nil, nil, map[string]interface{}{"x": 0.0}, WithPolicy("x", p)); err == nil {
+			t.Errorf("%s with null: no error", p)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package eval
+
+// Result is the outcome of EvalAll: the outputs of the rules that succeeded
+// and the errors of the rules that failed, in rule order.
+type Result struct {
+	Outputs map[string]interface{}
+	Errors  RuleErrors
+}
+
+// Err returns the errors of the failed rules, or nil when every rule
+// succeeded.
+func (r *Result) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return r.Errors
+}
@@ -0,0 +1,121 @@
+package eval
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+// Session is a working memory of named facts that the host changes over
+// time with Insert, Update and Retract. Fire evaluates the rules against the
+// facts known at that moment, always starting from the seeded outputs, so
+// outputs derived from a retracted or updated fact never linger. A declared
+// fact that is absent from the working memory reads as null.
+type Session struct {
+	mu      sync.Mutex
+	ast     parse.AST
+	funcMap map[string]interface{}
+	schema  map[string]interface{}
+	facts   map[string]interface{}
+	seed    map[string]interface{}
+	outputs map[string]interface{}
+	opts    []Option
+}
+
+// NewSession returns a session over the facts declared in schema, whose
+// values only give the types of the facts, as the inputMap of parse.Parse
+// does. The working memory starts with the facts of factMap, which must all
+// be declared.
+func NewSession(ast parse.AST, funcMap, schema, factMap, outputMap map[string]interface{}, opts ...Option) (*Session, error) {
+	for name := range factMap {
+		if _, ok := schema[name]; !ok {
+			return nil, fmt.Errorf("fact %q is not declared", name)
+		}
+	}
+	return &Session{
+		ast:     ast,
+		funcMap: funcMap,
+		schema:  copyMap(schema),
+		facts:   copyMap(factMap),
+		seed:    copyMap(outputMap),
+		outputs: copyMap(outputMap),
+		opts:    opts,
+	}, nil
+}
+
+// Insert adds a declared fact to the working memory, it fails if the fact
+// is already there.
+func (s *Session) Insert(name string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schema[name]; !ok {
+		return fmt.Errorf("fact %q is not declared", name)
+	}
+	if _, ok := s.facts[name]; ok {
+		return fmt.Errorf("fact %q already exists", name)
+	}
+	s.facts[name] = value
+	return nil
+}
+
+// Update replaces the value of an existing fact.
+func (s *Session) Update(name string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.facts[name]; !ok {
+		return fmt.Errorf("fact %q does not exist", name)
+	}
+	s.facts[name] = value
+	return nil
+}
+
+// Retract removes a fact from the working memory.
+func (s *Session) Retract(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.facts[name]; !ok {
+		return fmt.Errorf("fact %q does not exist", name)
+	}
+	delete(s.facts, name)
+	return nil
+}
+
+// Facts returns a copy of the facts currently in the working memory.
+func (s *Session) Facts() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyMap(s.facts)
+}
+
+// Outputs returns a copy of the outputs of the last successful Fire.
+func (s *Session) Outputs() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyMap(s.outputs)
+}
+
+// Fire evaluates the rules against the current facts. The outputs are only
+// replaced when the evaluation succeeds.
+func (s *Session) Fire() (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, err := New(s.funcMap, copyMap(s.facts), copyMap(s.seed), s.opts...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := e.Eval(s.ast)
+	if err != nil {
+		return nil, err
+	}
+	s.outputs = res
+	return copyMap(res), nil
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
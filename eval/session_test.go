@@ -0,0 +1,124 @@
+package eval
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+func newTestSession(t *testing.T, rules []string, schema, facts, outputs map[string]interface{}, opts ...Option) *Session {
+	t.Helper()
+	ast, err := parse.Parse(rules, nil, schema, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSession(ast, nil, schema, facts, outputs, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func fire(t *testing.T, s *Session, want map[string]interface{}) {
+	t.Helper()
+	got, err := s.Fire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fire() = %v, want %v", got, want)
+	}
+}
+
+func TestSessionDeclaredFacts(t *testing.T) {
+	// A rule reads a fact that has no value yet.
+	s := newTestSession(t, []string{"(item_count ?? 0) > 0 | has = true"},
+		map[string]interface{}{"item_count": 0.0}, nil, map[string]interface{}{"has": false})
+	fire(t, s, map[string]interface{}{"has": false})
+	if err := s.Insert("item_count", 1.0); err != nil {
+		t.Fatal(err)
+	}
+	fire(t, s, map[string]interface{}{"has": true})
+	if err := s.Insert("item_count", 2.0); err == nil {
+		t.Error("Insert of a present fact must fail")
+	}
+	if err := s.Insert("unknown", 1.0); err == nil {
+		t.Error("Insert of an undeclared fact must fail")
+	}
+}
+
+func TestSessionCart(t *testing.T) {
+	// Items are added to the cart one at a time.
+	schema := map[string]interface{}{"item_1": 0.0, "item_2": 0.0, "item_3": 0.0}
+	s := newTestSession(t, []string{
+		"exists(item_1) | total += item_1, count += 1",
+		"exists(item_2) | total += item_2, count += 1",
+		"exists(item_3) | total += item_3, count += 1",
+		"count > 2 | free_shipping = true",
+	}, schema, nil, map[string]interface{}{"total": 0.0, "count": 0.0, "free_shipping": false})
+	fire(t, s, map[string]interface{}{"total": 0.0, "count": 0.0, "free_shipping": false})
+	for i, price := range []float64{10, 20, 30} {
+		if err := s.Insert([]string{"item_1", "item_2", "item_3"}[i], price); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fire(t, s, map[string]interface{}{"total": 60.0, "count": 3.0, "free_shipping": true})
+	if err := s.Update("item_2", 5.0); err != nil {
+		t.Fatal(err)
+	}
+	fire(t, s, map[string]interface{}{"total": 45.0, "count": 3.0, "free_shipping": true})
+	if err := s.Retract("item_3"); err != nil {
+		t.Fatal(err)
+	}
+	// Outputs derived from the retracted fact are gone.
+	fire(t, s, map[string]interface{}{"total": 15.0, "count": 2.0, "free_shipping": false})
+	if !reflect.DeepEqual(s.Facts(), map[string]interface{}{"item_1": 10.0, "item_2": 5.0}) {
+		t.Errorf("Facts() = %v", s.Facts())
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	schema := map[string]interface{}{"a": 0.0}
+	ast, err := parse.Parse([]string{"x = a"}, nil, schema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSession(ast, nil, schema, map[string]interface{}{"b": 1.0}, nil); err == nil {
+		t.Error("NewSession with an undeclared fact must fail")
+	}
+	s, err := NewSession(ast, nil, schema, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Update("a", 1.0); err == nil {
+		t.Error("Update of an absent fact must fail")
+	}
+	if err := s.Retract("a"); err == nil {
+		t.Error("Retract of an absent fact must fail")
+	}
+	if err := s.Insert("a", 1.0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Retract("a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Facts()) != 0 {
+		t.Errorf("Facts() = %v after Retract", s.Facts())
+	}
+}
+
+func TestSessionFireFailureKeepsOutputs(t *testing.T) {
+	s := newTestSession(t, []string{"x = 10 / a"}, map[string]interface{}{"a": 0.0},
+		map[string]interface{}{"a": 2.0}, map[string]interface{}{"x": 0.0})
+	fire(t, s, map[string]interface{}{"x": 5.0})
+	if err := s.Update("a", "text"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Fire(); err == nil {
+		t.Fatal("Fire must fail on a string fact")
+	}
+	if !reflect.DeepEqual(s.Outputs(), map[string]interface{}{"x": 5.0}) {
+		t.Errorf("Outputs() = %v after a failed Fire", s.Outputs())
+	}
+}
@@ -0,0 +1,140 @@
+package eval
+
+import (
+	"fmt"
+	"time"
+)
+
+func isTimeValue(v interface{}) bool {
+	switch v.(type) {
+	case time.Time, time.Duration:
+		return true
+	}
+	return false
+}
+
+// evalTimeMath evaluates the arithmetic of dates and durations, a duration
+// can be scaled by a number and the difference of two dates is a duration.
+func evalTimeMath(op string, l, r interface{}) (interface{}, error) {
+	switch lv := l.(type) {
+	case time.Time:
+		switch rv := r.(type) {
+		case time.Time:
+			if op == "-" {
+				return lv.Sub(rv), nil
+			}
+		case time.Duration:
+			switch op {
+			case "+":
+				return lv.Add(rv), nil
+			case "-":
+				return lv.Add(-rv), nil
+			}
+		}
+	case time.Duration:
+		switch rv := r.(type) {
+		case time.Time:
+			if op == "+" {
+				return rv.Add(lv), nil
+			}
+		case time.Duration:
+			switch op {
+			case "+":
+				return lv + rv, nil
+			case "-":
+				return lv - rv, nil
+			case "/":
+				if rv == 0 {
+					return nil, fmt.Errorf("division by zero duration")
+				}
+				return float64(lv) / float64(rv), nil
+			case "%":
+				if rv == 0 {
+					return nil, fmt.Errorf("division by zero duration")
+				}
+				return lv % rv, nil
+			}
+		default:
+			if f, ok := toFloat(r); ok {
+				switch op {
+				case "*":
+					return time.Duration(float64(lv) * f), nil
+				case "/":
+					if f == 0 {
+						return nil, fmt.Errorf("division by zero")
+					}
+					return time.Duration(float64(lv) / f), nil
+				}
+			}
+		}
+	default:
+		if rv, ok := r.(time.Duration); ok && op == "*" {
+			if f, ok := toFloat(l); ok {
+				return time.Duration(f * float64(rv)), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("operator %s not defined on %T and %T", op, l, r)
+}
+
+// evalTimeCompare compares two dates or two durations.
+func evalTimeCompare(op string, l, r interface{}) (bool, error) {
+	var c int
+	switch lv := l.(type) {
+	case time.Time:
+		rv, ok := r.(time.Time)
+		if !ok {
+			break
+		}
+		switch {
+		case lv.Before(rv):
+			c = -1
+		case lv.After(rv):
+			c = 1
+		}
+		return compareResult(op, c), nil
+	case time.Duration:
+		rv, ok := r.(time.Duration)
+		if !ok {
+			break
+		}
+		switch {
+		case lv < rv:
+			c = -1
+		case lv > rv:
+			c = 1
+		}
+		return compareResult(op, c), nil
+	}
+	switch op {
+	case "==":
+		return false, nil
+	case "!=":
+		return true, nil
+	}
+	return false, fmt.Errorf("operator %s not defined on %T and %T", op, l, r)
+}
+
+func compareResult(op string, c int) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	rv, err := convert(v, floatType)
+	if err != nil {
+		return 0, false
+	}
+	return rv.Float(), true
+}
@@ -0,0 +1,69 @@
+package eval
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var timeInputs = map[string]interface{}{
+	"d":    time.Date(2024, 3, 21, 12, 0, 0, 0, time.UTC),
+	"wait": 2 * time.Hour,
+	"n":    2.0,
+}
+
+func TestDateArithmetic(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		want interface{}
+		err  string
+	}{
+		{expr: "@2024-03-20+1d", want: time.Date(2024, 3, 21, 0, 0, 0, 0, time.UTC)},
+		{expr: "@2024-03-20 - 1d", want: time.Date(2024, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{expr: "@2024-03-20-12h", want: time.Date(2024, 3, 19, 12, 0, 0, 0, time.UTC)},
+		{expr: "@2024-03-20T10:00:00+03:30+1h", want: time.Date(2024, 3, 20, 7, 30, 0, 0, time.UTC)},
+		{expr: "1d + @2024-03-20", want: time.Date(2024, 3, 21, 0, 0, 0, 0, time.UTC)},
+		{expr: "d - @2024-03-20", want: 36 * time.Hour},
+		{expr: "d > @2024-03-20+1d", want: true},
+		{expr: "d < @2024-03-20+2d", want: true},
+		{expr: "d == @2024-03-21T12:00", want: true},
+		{expr: "d - @2024-03-20 > 1d", want: true},
+		{expr: "1h30m + wait", want: 210 * time.Minute},
+		{expr: "wait - 30m", want: 90 * time.Minute},
+		{expr: "wait * n", want: 4 * time.Hour},
+		{expr: "n * wait", want: 4 * time.Hour},
+		{expr: "wait / 4", want: 30 * time.Minute},
+		{expr: "1d / wait", want: 12.0},
+		{expr: "1d % 5h", want: 4 * time.Hour},
+		{expr: "wait >= 2h", want: true},
+		{expr: "@2024-03-20 + @2024-03-21", err: "operator + not defined on time.Time and time.Time"},
+		{expr: "1d - @2024-03-20", err: "operator - not defined"},
+		{expr: "d + 1", err: "operator + not defined"},
+		{expr: "wait / 0s", err: "division by zero duration"},
+		{expr: "wait / 0", err: "division by zero"},
+		{expr: "d > 1", err: "operator > not defined on time.Time and float64"},
+		{expr: "d == 1", want: false},
+	} {
+		got, err := evalExpr(t, c.expr, timeInputs, timeInputs)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error %v, want %q", c.expr, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if want, ok := c.want.(time.Time); ok {
+			if got, ok := got.(time.Time); !ok || !got.Equal(want) {
+				t.Errorf("%s = %v, want %v", c.expr, got, want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %#v, want %#v", c.expr, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package eval
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	intType   = reflect.TypeOf(int(0))
+	uint8Type = reflect.TypeOf(uint8(0))
+)
+
+func TestOutputTypes(t *testing.T) {
+	inputs := map[string]interface{}{"half": 1.5, "s": "a", "none": nil}
+	for _, c := range []struct {
+		rules   []string
+		outputs map[string]interface{}
+		opts    []Option
+		want    map[string]interface{}
+	}{
+		// Values take the type of the current value.
+		{[]string{"n = 0"}, map[string]interface{}{"n": int(7)}, nil, map[string]interface{}{"n": int(0)}},
+		{[]string{"n = 200"}, map[string]interface{}{"n": uint8(1)}, nil, map[string]interface{}{"n": uint8(200)}},
+		{[]string{"n = half"}, map[string]interface{}{"n": float32(0)}, nil, map[string]interface{}{"n": float32(1.5)}},
+		{[]string{"d = 2h"}, map[string]interface{}{"d": time.Duration(0)}, nil, map[string]interface{}{"d": 2 * time.Hour}},
+		{[]string{"tags = none"}, map[string]interface{}{"tags": []string{"a"}}, nil, map[string]interface{}{"tags": nil}},
+		// Outputs without a value keep any type.
+		{[]string{"n = s"}, nil, nil, map[string]interface{}{"n": "a"}},
+		{[]string{"n = s"}, map[string]interface{}{"n": nil}, nil, map[string]interface{}{"n": "a"}},
+		// A declared type wins over the current value.
+		{[]string{"n = 3"}, nil, []Option{WithOutputType("n", intType)}, map[string]interface{}{"n": int(3)}},
+		{[]string{"n = 3"}, map[string]interface{}{"n": 1.0}, []Option{WithOutputType("n", uint8Type)}, map[string]interface{}{"n": uint8(3)}},
+		{[]string{"n += 2", "n += 2"}, nil, []Option{WithOutputType("n", intType)}, map[string]interface{}{"n": int(4)}},
+		// Collected outputs are lists, their values are not converted.
+		{[]string{"n = half"}, map[string]interface{}{"n": int(0)}, []Option{WithPolicy("n", Collect)}, map[string]interface{}{"n": []interface{}{1.5}}},
+	} {
+		got, err := evalRules(t, c.rules, nil, inputs, c.outputs, c.opts...)
+		if err != nil {
+			t.Errorf("%q: %v", c.rules, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q = %#v, want %#v", c.rules, got, c.want)
+		}
+	}
+}
+
+func TestOutputTypeErrors(t *testing.T) {
+	inputs := map[string]interface{}{"half": 1.5, "s": "a", "none": nil}
+	for _, c := range []struct {
+		rules   []string
+		outputs map[string]interface{}
+		opts    []Option
+		err     string
+	}{
+		{[]string{"n = half"}, map[string]interface{}{"n": int(0)}, nil, `output "n" of type int cannot hold float64 1.5 at line 0 char 1`},
+		{[]string{"n = 256"}, map[string]interface{}{"n": uint8(0)}, nil, `output "n" of type uint8 cannot hold float64 256`},
+		{[]string{"n = -1"}, map[string]interface{}{"n": uint(0)}, nil, `output "n" of type uint cannot hold float64 -1`},
+		{[]string{"n = s"}, map[string]interface{}{"n": 0.0}, nil, `output "n" of type float64 cannot hold string a`},
+		{[]string{"n = none"}, map[string]interface{}{"n": int(7)}, nil, `output "n" of type int cannot hold null at line 0 char 1`},
+		{[]string{"d = 2"}, map[string]interface{}{"d": time.Duration(0)}, nil, `output "d" of type time.Duration cannot hold float64 2`},
+		{[]string{"n = 1", "n = s"}, nil, []Option{WithOutputType("n", intType)}, `output "n" of type int cannot hold string a at line 1 char 1`},
+		{[]string{"n = half"}, nil, []Option{WithOutputType("n", intType)}, `output "n" of type int cannot hold float64 1.5`},
+	} {
+		_, err := evalRules(t, c.rules, nil, inputs, c.outputs, c.opts...)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: error %v, want %q", c.rules, err, c.err)
+		}
+	}
+}
+
+// WithTypeChanges keeps values that cannot be converted, values that can
+// still are.
+func TestTypeChanges(t *testing.T) {
+	inputs := map[string]interface{}{"half": 1.5, "s": "a"}
+	outputs := map[string]interface{}{"n": int(0), "m": int(0), "label": 0.0}
+	got, err := evalRules(t, []string{"n = half", "m = 2", "label = s"}, nil, inputs, outputs, WithTypeChanges())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"n": 1.5, "m": int(2), "label": "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("outputs = %#v, want %#v", got, want)
+	}
+
+	got, err = evalRules(t, []string{"n = s"}, nil, inputs, nil, WithOutputType("n", intType), WithTypeChanges())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["n"] != "a" {
+		t.Errorf("n = %#v, want \"a\"", got["n"])
+	}
+}
@@ -0,0 +1,95 @@
+// Package rulegen writes random rules for the round trip tests of the
+// printer and the serializer.
+package rulegen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Gen writes random rules, with random parentheses, over the number inputs
+// a and b, the string input s, the bool input flag, the map input user, the
+// outputs x, y, z and tags, and the functions half and max.
+type Gen struct {
+	*rand.Rand
+}
+
+// New returns a generator seeded with seed, so tests see the same rules on
+// every run.
+func New(seed int64) Gen {
+	return Gen{rand.New(rand.NewSource(seed))}
+}
+
+func (g Gen) pick(s ...string) string {
+	return s[g.Intn(len(s))]
+}
+
+func (g Gen) paren(s string) string {
+	if g.Intn(4) == 0 {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func (g Gen) number(depth int) string {
+	if depth <= 0 {
+		return g.pick("a", "b", "x", "0", "2", "-1.5", "۱۲", "0x10", "half(a)")
+	}
+	if g.Intn(6) == 0 {
+		return fmt.Sprintf("max(%s, %s)", g.number(depth-1), g.number(depth-1))
+	}
+	return g.paren(fmt.Sprintf("%s %s %s", g.number(depth-1), g.pick("+", "-", "*", "/", "%", "??"), g.number(depth-1)))
+}
+
+func (g Gen) condition(depth int) string {
+	if depth <= 0 {
+		switch g.Intn(5) {
+		case 0:
+			return g.pick("flag", "!flag", "true", "false", "!(a > b)")
+		case 1:
+			return fmt.Sprintf("s %s %q", g.pick("==", "!="), g.pick("tehran", `qu"ote`))
+		case 2:
+			return g.pick("exists(a)", "exists(user)", `user?.city == "kish"`)
+		}
+		return fmt.Sprintf("%s %s %s", g.number(2), g.pick("==", "!=", ">", "<", ">=", "<="), g.number(2))
+	}
+	return g.paren(fmt.Sprintf("%s %s %s", g.condition(depth-1), g.pick("&&", "||", "==", "!="), g.condition(depth-1)))
+}
+
+func (g Gen) action() string {
+	switch g.Intn(5) {
+	case 0:
+		return fmt.Sprintf("x %s %s", g.pick("=", "+=", "-=", "*=", "/="), g.number(3))
+	case 1:
+		return fmt.Sprintf("y = %s", g.condition(2))
+	case 2:
+		return `z = (z ?? "") + s`
+	case 3:
+		return fmt.Sprintf("tags append %s", g.pick(`"a"`, "s", g.number(1)))
+	}
+	return fmt.Sprintf("x = %s", g.number(2))
+}
+
+// Rule returns a rule of one to three actions, most of the time behind a
+// condition.
+func (g Gen) Rule() string {
+	actions := make([]string, 1+g.Intn(3))
+	for i := range actions {
+		actions[i] = g.action()
+	}
+	s := strings.Join(actions, ", ")
+	if g.Intn(5) == 0 {
+		return s
+	}
+	return g.condition(3) + " | " + s
+}
+
+// Rules returns one to four rules.
+func (g Gen) Rules() []string {
+	rules := make([]string, 1+g.Intn(4))
+	for i := range rules {
+		rules[i] = g.Rule()
+	}
+	return rules
+}
@@ -0,0 +1,147 @@
+// Package jalali converts between the Solar Hijri (Jalali) and the Gregorian
+// calendars. The leap years follow the break table of the astronomical
+// calendar, which is exact for the years 1 to 3177.
+package jalali
+
+import (
+	"fmt"
+	"time"
+)
+
+// breaks are the years the 33 year cycles of the calendar restart on.
+var breaks = [...]int{-61, 9, 38, 199, 426, 686, 756, 818, 1111, 1181, 1210, 1635, 2060, 2097, 2192, 2262, 2324, 2394, 2456, 3178}
+
+// MinYear and MaxYear are the first and the last year the package converts.
+const (
+	MinYear = 1
+	MaxYear = 3177
+)
+
+// cal returns the gregorian year that starts in year, the day of march
+// Nowruz falls on, and the number of years since the last leap year.
+func cal(year int) (gy, march, leap int) {
+	gy = year + 621
+	leapJ := -14
+	jp := breaks[0]
+	var jump int
+	for i := 1; i < len(breaks); i++ {
+		jm := breaks[i]
+		jump = jm - jp
+		if year < jm {
+			break
+		}
+		leapJ += jump/33*8 + jump%33/4
+		jp = jm
+	}
+	n := year - jp
+	leapJ += n/33*8 + (n%33+3)/4
+	if jump%33 == 4 && jump-n == 4 {
+		leapJ++
+	}
+	leapG := gy/4 - (gy/100+1)*3/4 - 150
+	march = 20 + leapJ - leapG
+	if jump-n < 6 {
+		n = n - jump + (jump+4)/33*33
+	}
+	leap = ((n+1)%33 - 1) % 4
+	if leap == -1 {
+		leap = 4
+	}
+	return gy, march, leap
+}
+
+func validYear(year int) error {
+	if year < MinYear || year > MaxYear {
+		return fmt.Errorf("jalali year %d out of range", year)
+	}
+	return nil
+}
+
+// IsLeap reports whether year has 366 days.
+func IsLeap(year int) bool {
+	if validYear(year) != nil {
+		return false
+	}
+	_, _, leap := cal(year)
+	return leap == 0
+}
+
+// MonthDays returns the number of days in month of year.
+func MonthDays(year, month int) int {
+	switch {
+	case month <= 6:
+		return 31
+	case month <= 11:
+		return 30
+	case IsLeap(year):
+		return 30
+	}
+	return 29
+}
+
+// Date returns the time of the given jalali date in loc.
+func Date(year, month, day, hour, min, sec int, loc *time.Location) (time.Time, error) {
+	if err := validYear(year); err != nil {
+		return time.Time{}, err
+	}
+	if month < 1 || month > 12 || day < 1 || day > MonthDays(year, month) {
+		return time.Time{}, fmt.Errorf("invalid jalali date %04d/%02d/%02d", year, month, day)
+	}
+	gy, march, _ := cal(year)
+	days := (month-1)*31 - month/7*(month-7) + day - 1
+	return time.Date(gy, time.March, march+days, hour, min, sec, 0, loc), nil
+}
+
+// FromTime returns the jalali date of t in the location of t. It fails
+// when the date is not in the years MinYear to MaxYear.
+func FromTime(t time.Time) (year, month, day int, err error) {
+	gy, gm, gd := t.Date()
+	start := func(year int) time.Time {
+		_, march, _ := cal(year)
+		return time.Date(year+621, time.March, march, 0, 0, 0, 0, time.UTC)
+	}
+	year = gy - 621
+	date := time.Date(gy, gm, gd, 0, 0, 0, 0, time.UTC)
+	if date.Before(start(year)) {
+		year--
+	}
+	if err := validYear(year); err != nil {
+		return 0, 0, 0, err
+	}
+	k := int(date.Sub(start(year)).Hours() / 24)
+	if k < 186 {
+		return year, 1 + k/31, k%31 + 1, nil
+	}
+	k -= 186
+	return year, 7 + k/30, k%30 + 1, nil
+}
+
+// Weekday returns the day of the week of t, starting from 0 for saturday.
+func Weekday(t time.Time) int {
+	return (int(t.Weekday()) + 1) % 7
+}
+
+// AddMonths adds months jalali months to t. The day is clamped to the
+// length of the resulting month, so 1402/06/31 plus one month is 1402/07/30.
+// It fails when t or the result is not in the years MinYear to MaxYear.
+func AddMonths(t time.Time, months int) (time.Time, error) {
+	y, m, d, err := FromTime(t)
+	if err != nil {
+		return time.Time{}, err
+	}
+	m += months
+	y += (m - 1) / 12
+	m = (m-1)%12 + 1
+	if m < 1 {
+		m += 12
+		y--
+	}
+	if n := MonthDays(y, m); d > n {
+		d = n
+	}
+	r, err := Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Location())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return r.Add(time.Duration(t.Nanosecond())), nil
+}
@@ -0,0 +1,201 @@
+package jalali
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+var conversions = []struct {
+	year, month, day int
+	t                time.Time
+}{
+	{1399, 12, 30, date(2021, 3, 20)},
+	{1400, 1, 1, date(2021, 3, 21)},
+	{1402, 6, 31, date(2023, 9, 22)},
+	{1402, 7, 1, date(2023, 9, 23)},
+	{1402, 12, 29, date(2024, 3, 19)},
+	{1403, 1, 1, date(2024, 3, 20)},
+	{1403, 1, 15, date(2024, 4, 3)},
+	{1403, 12, 30, date(2025, 3, 20)},
+	{1404, 1, 1, date(2025, 3, 21)},
+	{1404, 12, 29, date(2026, 3, 20)},
+	{1408, 12, 30, date(2030, 3, 20)},
+	{1409, 1, 1, date(2030, 3, 21)},
+}
+
+func TestDate(t *testing.T) {
+	for _, c := range conversions {
+		got, err := Date(c.year, c.month, c.day, 0, 0, 0, time.UTC)
+		if err != nil {
+			t.Errorf("Date(%d, %d, %d): %v", c.year, c.month, c.day, err)
+			continue
+		}
+		if !got.Equal(c.t) {
+			t.Errorf("Date(%d, %d, %d) = %s, want %s", c.year, c.month, c.day, got, c.t)
+		}
+	}
+}
+
+func TestFromTime(t *testing.T) {
+	for _, c := range conversions {
+		// The time of day does not change the date.
+		for _, tm := range []time.Time{c.t, c.t.Add(23*time.Hour + 59*time.Minute)} {
+			y, m, d, err := FromTime(tm)
+			if err != nil || y != c.year || m != c.month || d != c.day {
+				t.Errorf("FromTime(%s) = %d/%d/%d, %v, want %d/%d/%d", tm, y, m, d, err, c.year, c.month, c.day)
+			}
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	first, err := Date(MinYear, 1, 1, 0, 0, 0, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := Date(MaxYear, 12, MonthDays(MaxYear, 12), 0, 0, 0, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		t    time.Time
+		want [3]int
+	}{
+		{first, [3]int{MinYear, 1, 1}},
+		{last, [3]int{MaxYear, 12, MonthDays(MaxYear, 12)}},
+	} {
+		y, m, d, err := FromTime(c.t)
+		if err != nil || [3]int{y, m, d} != c.want {
+			t.Errorf("FromTime(%s) = %d/%d/%d, %v, want %v", c.t, y, m, d, err, c.want)
+		}
+	}
+	for _, tm := range []time.Time{time.Time{}, first.AddDate(0, 0, -1), last.AddDate(0, 0, 1)} {
+		if y, m, d, err := FromTime(tm); err == nil {
+			t.Errorf("FromTime(%s) = %d/%d/%d, want an error", tm, y, m, d)
+		}
+	}
+}
+
+func TestIsLeap(t *testing.T) {
+	for year, want := range map[int]bool{
+		1395: true,
+		1399: true,
+		1400: false,
+		1402: false,
+		1403: true,
+		1404: false,
+		1407: false,
+		1408: true,
+		0:    false,
+		3178: false,
+	} {
+		if got := IsLeap(year); got != want {
+			t.Errorf("IsLeap(%d) = %t, want %t", year, got, want)
+		}
+	}
+}
+
+func TestEsfand30(t *testing.T) {
+	for _, year := range []int{1399, 1403, 1408} {
+		if n := MonthDays(year, 12); n != 30 {
+			t.Errorf("MonthDays(%d, 12) = %d, want 30", year, n)
+		}
+		if _, err := Date(year, 12, 30, 0, 0, 0, time.UTC); err != nil {
+			t.Errorf("Date(%d, 12, 30): %v", year, err)
+		}
+	}
+	for _, year := range []int{1400, 1402, 1404} {
+		if n := MonthDays(year, 12); n != 29 {
+			t.Errorf("MonthDays(%d, 12) = %d, want 29", year, n)
+		}
+		if _, err := Date(year, 12, 30, 0, 0, 0, time.UTC); err == nil {
+			t.Errorf("Date(%d, 12, 30): no error", year)
+		}
+	}
+}
+
+func TestDateErrors(t *testing.T) {
+	for _, d := range [][3]int{
+		{0, 1, 1},
+		{3178, 1, 1},
+		{1403, 0, 1},
+		{1403, 13, 1},
+		{1403, 1, 0},
+		{1403, 1, 32},
+		{1403, 7, 31},
+	} {
+		if _, err := Date(d[0], d[1], d[2], 0, 0, 0, time.UTC); err == nil {
+			t.Errorf("Date(%d, %d, %d): no error", d[0], d[1], d[2])
+		}
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	for _, c := range []struct {
+		from   [3]int
+		months int
+		want   [3]int
+	}{
+		{[3]int{1403, 1, 1}, 1, [3]int{1403, 2, 1}},
+		{[3]int{1403, 1, 1}, 12, [3]int{1404, 1, 1}},
+		{[3]int{1403, 1, 1}, -1, [3]int{1402, 12, 1}},
+		{[3]int{1403, 1, 1}, -13, [3]int{1401, 12, 1}},
+		{[3]int{1403, 11, 15}, 2, [3]int{1404, 1, 15}},
+		// The day is clamped to the length of the month.
+		{[3]int{1402, 6, 31}, 1, [3]int{1402, 7, 30}},
+		{[3]int{1403, 6, 31}, 6, [3]int{1403, 12, 30}},
+		{[3]int{1404, 6, 31}, 6, [3]int{1404, 12, 29}},
+		{[3]int{1403, 12, 30}, 12, [3]int{1404, 12, 29}},
+		{[3]int{1403, 12, 30}, -48, [3]int{1399, 12, 30}},
+	} {
+		from, err := Date(c.from[0], c.from[1], c.from[2], 10, 30, 0, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := AddMonths(from, c.months)
+		if err != nil {
+			t.Errorf("AddMonths(%v, %d): %v", c.from, c.months, err)
+			continue
+		}
+		y, m, d, err := FromTime(got)
+		if err != nil || [3]int{y, m, d} != c.want {
+			t.Errorf("AddMonths(%v, %d) = %d/%d/%d, want %v", c.from, c.months, y, m, d, c.want)
+		}
+		if got.Hour() != 10 || got.Minute() != 30 {
+			t.Errorf("AddMonths(%v, %d) changed the time of day to %s", c.from, c.months, got)
+		}
+	}
+}
+
+func TestAddMonthsErrors(t *testing.T) {
+	last, err := Date(MaxYear, 12, 1, 0, 0, 0, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		t      time.Time
+		months int
+	}{
+		{time.Time{}, 1},
+		{last, 1},
+		{date(2024, 3, 20), -1403 * 12},
+	} {
+		if got, err := AddMonths(c.t, c.months); err == nil {
+			t.Errorf("AddMonths(%s, %d) = %s, want an error", c.t, c.months, got)
+		}
+	}
+}
+
+func TestWeekday(t *testing.T) {
+	// 1403/01/01 is a wednesday, the fifth day of the jalali week.
+	if got := Weekday(date(2024, 3, 20)); got != 4 {
+		t.Errorf("Weekday(1403/01/01) = %d, want 4", got)
+	}
+	if got := Weekday(date(2024, 3, 23)); got != 0 {
+		t.Errorf("Weekday(saturday) = %d, want 0", got)
+	}
+}
@@ -1,6 +1,9 @@
 package parse
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type Node interface {
 	Pos() Position
@@ -111,6 +114,30 @@ func (n StringNode) String() string {
 	return s
 }
 
+type DurationNode struct {
+	Position
+	Duration time.Duration
+	Text     string
+}
+
+func (n DurationNode) String() string {
+	s := "->DurationNode "
+	s += fmt.Sprintf("%s\n", n.Text)
+	return s
+}
+
+type DateNode struct {
+	Position
+	Time time.Time
+	Text string
+}
+
+func (n DateNode) String() string {
+	s := "->DateNode "
+	s += fmt.Sprintf("%s\n", n.Text)
+	return s
+}
+
 type BoolNode struct {
 	Position
 	IsTrue bool
@@ -134,14 +161,17 @@ func (n NotNode) String() string {
 	return s
 }
 
+// AssingmentNode assigns the right expression to a variable. Operator is
+// "=", a compound assignment ("+=", "-=", "*=", "/=") or "append".
 type AssingmentNode struct {
 	Position
+	Operator        string
 	Variable        *VariableNode
 	RightExpression *ExpressionNode
 }
 
 func (n AssingmentNode) String() string {
-	s := "->AssingmentNode\n"
+	s := fmt.Sprintf("->AssingmentNode %s\n", n.Operator)
 	s += fmt.Sprintf("Variable\n%s", n.Variable)
 	s += fmt.Sprintf("RightExpression\n%s", n.RightExpression)
 	s += "<-AssingmentNode\n"
@@ -163,11 +193,50 @@ type IdentifierNode struct {
 	Position
 	Identifier string
 	IsInput    bool
+	Path       []Selector
 }
 
 func (n IdentifierNode) String() string {
 	s := "->IdentifierNode "
-	s += fmt.Sprintf("input:%v %s\n", n.IsInput, n.Identifier)
+	s += fmt.Sprintf("input:%v %s", n.IsInput, n.Identifier)
+	for _, sel := range n.Path {
+		s += sel.String()
+	}
+	s += "\n"
+	return s
+}
+
+// Selector selects a key of a map or a field of a struct, an optional
+// selector ('?.') yields null instead of failing on a null value.
+type Selector struct {
+	Name     string
+	Optional bool
+}
+
+func (s Selector) String() string {
+	if s.Optional {
+		return "?." + s.Name
+	}
+	return "." + s.Name
+}
+
+type NullNode struct {
+	Position
+}
+
+func (n NullNode) String() string {
+	return "->NullNode\n"
+}
+
+type ExistsNode struct {
+	Position
+	Identifier *IdentifierNode
+}
+
+func (n ExistsNode) String() string {
+	s := "->ExistsNode\n"
+	s += fmt.Sprintf("Identifier\n%s", n.Identifier)
+	s += "<-ExistsNode\n"
 	return s
 }
 
@@ -177,6 +246,7 @@ type MathExpressionNode struct {
 	IsAditive       bool
 	IsProductive    bool
 	IsMod           bool
+	IsCoalesce      bool
 	Type            itemType
 	LeftExpression  Node
 	RightExpression Node
@@ -190,6 +260,40 @@ func (n MathExpressionNode) String() string {
 	return s
 }
 
+// NewMathExpressionNode returns the node of the arithmetic operator op, one of
+// "+", "-", "*", "/", "%" and "??".
+func NewMathExpressionNode(pos Position, op string, left, right Node) (*MathExpressionNode, error) {
+	typ, ok := mathOperators[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown math operator %q", op)
+	}
+	n := newMathExpressionNode(pos, typ, op)
+	n.LeftExpression = left
+	n.RightExpression = right
+	return n, nil
+}
+
+var mathOperators = map[string]itemType{
+	"+":  itemAdd,
+	"-":  itemMinus,
+	"*":  itemPow,
+	"/":  itemDiv,
+	"%":  itemMod,
+	"??": itemCoalesce,
+}
+
+func newMathExpressionNode(pos Position, typ itemType, op string) *MathExpressionNode {
+	return &MathExpressionNode{
+		IsMod:        typ == itemMod,
+		IsCoalesce:   typ == itemCoalesce,
+		IsAditive:    typ == itemMinus || typ == itemAdd,
+		IsProductive: typ == itemPow || typ == itemDiv,
+		Position:     pos,
+		Identifier:   op,
+		Type:         typ,
+	}
+}
+
 type ConditionalExpressionNode struct {
 	Position
 	Identifier      string
@@ -207,3 +311,37 @@ func (n ConditionalExpressionNode) String() string {
 	s += "<-ConditionalExpressionNode\n"
 	return s
 }
+
+// NewConditionalExpressionNode returns the node of the comparison or boolean
+// operator op, one of "==", "!=", ">", "<", ">=", "<=", "&&" and "||".
+func NewConditionalExpressionNode(pos Position, op string, left, right Node) (*ConditionalExpressionNode, error) {
+	typ, ok := conditionalOperators[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown conditional operator %q", op)
+	}
+	n := newConditionalExpressionNode(pos, typ, op)
+	n.LeftExpression = left
+	n.RightExpression = right
+	return n, nil
+}
+
+var conditionalOperators = map[string]itemType{
+	"==": itemEquals,
+	"!=": itemNotEquals,
+	">":  itemGreaters,
+	"<":  itemLowers,
+	">=": itemGreaterEquals,
+	"<=": itemLowerEquals,
+	"&&": itemAnd,
+	"||": itemOr,
+}
+
+func newConditionalExpressionNode(pos Position, typ itemType, op string) *ConditionalExpressionNode {
+	return &ConditionalExpressionNode{
+		IsBooleanBase: typ == itemOr || typ == itemAnd,
+		IsDiffBase:    typ == itemEquals || typ == itemNotEquals || typ == itemGreaterEquals || typ == itemLowerEquals || typ == itemGreaters || typ == itemLowers,
+		Position:      pos,
+		Identifier:    op,
+		Type:          typ,
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/sazito/mosalat/persian"
 )
 
 type item struct {
@@ -63,6 +65,12 @@ const (
 	itemString              // quoted string (includes quotes)
 	itemSeprator
 	itemVariable
+	itemDuration       // duration literal ('14d', '1h30m')
+	itemDate           // date literal ('@2024-03-20')
+	itemNull           // null constant
+	itemCoalesce       // null coalescing ('??')
+	itemCompoundAssign // compound assignment ('+=', '-=', '*=', '/=')
+	itemAppend         // list append ('append')
 )
 
 const eof = -1
@@ -224,12 +232,23 @@ func lex(input []string) *lexer {
 		input: input,
 		items: make(chan item),
 	}
-	go l.run()
+	go l.run(lexBlock)
+	return l
+}
+
+// lexExpr returns a lexer over a single expression, which is not part of a
+// rule and ends at the end of the input.
+func lexExpr(input string) *lexer {
+	l := &lexer{
+		input: []string{input},
+		items: make(chan item),
+	}
+	go l.run(lexExpression)
 	return l
 }
 
-func (l *lexer) run() {
-	for state := lexBlock; state != nil; {
+func (l *lexer) run(start stateFn) {
+	for state := start; state != nil; {
 		state = state(l)
 	}
 	close(l.items)
@@ -291,21 +310,27 @@ func lexInsideCondition(l *lexer) stateFn {
 	return lexInsideExpression
 }
 
+func lexExpression(l *lexer) stateFn {
+	l.pushState(lexExpression)
+	return lexInsideExpression
+}
+
 func lexInsideExpression(l *lexer) stateFn {
 	parentFn := l.peekState()
-	if isStateFnEqual(parentFn, lexInsideCondition) {
-		atDelim := l.atDelim()
-		if atDelim {
-			if l.parenDepth == 0 {
-				l.popState()
-				return lexRightOfCondition
-			}
-			return l.errorf("unclosed left paren")
-		}
-		if l.peek() == ',' {
-			l.next()
-			return l.errorf("unrecognized character in expression: %#U", ',')
+	inCondition := isStateFnEqual(parentFn, lexInsideCondition)
+	if inCondition && l.atDelim() {
+		if l.parenDepth == 0 {
+			l.popState()
+			return lexRightOfCondition
 		}
+		return l.errorf("unclosed left paren")
+	}
+	if isStateFnEqual(parentFn, lexExpression) && l.atDelim() {
+		return l.errorf("%q is a rule, not an expression", l.input[l.index])
+	}
+	if (inCondition || isStateFnEqual(parentFn, lexExpression)) && l.peek() == ',' {
+		l.next()
+		return l.errorf("unrecognized character in expression: %#U", ',')
 	}
 	switch r := l.next(); {
 	case r == eof:
@@ -316,6 +341,14 @@ func lexInsideExpression(l *lexer) stateFn {
 			}
 			return lexRightOfAction
 		}
+		if isStateFnEqual(parentFn, lexExpression) {
+			l.popState()
+			if l.parenDepth != 0 {
+				return l.errorf("unclosed left paren")
+			}
+			l.emit(itemEOF)
+			return nil
+		}
 		return l.errorf("unclosed expression")
 	case isSpace(r):
 		l.backup()
@@ -379,9 +412,16 @@ func lexInsideExpression(l *lexer) stateFn {
 		if isSpace(l.peek()) {
 			l.emit(itemMod)
 		}
+	case r == '?':
+		if l.next() != '?' {
+			return l.errorf("expected ??")
+		}
+		l.emit(itemCoalesce)
 	case r == '"':
 		return lexQuote
-	case r == '+' || r == '-' || ('0' <= r && r <= '9'):
+	case r == '@':
+		return lexDate
+	case r == '+' || r == '-' || ('0' <= r && r <= '9') || persian.IsDigit(r):
 		l.backup()
 		return lexNumber
 	case isAlphaNumeric(r):
@@ -451,7 +491,21 @@ Loop:
 					l.errorf("no assignment found")
 				}
 			default:
-				l.errorf("no assignment found")
+				l.pos = pos
+				l.width = w
+				l.emit(itemVariable)
+				l.ignoreSpace()
+				switch op := l.input[l.index][l.pos:]; {
+				case len(op) > 1 && strings.ContainsRune("+-*/", rune(op[0])) && op[1] == '=':
+					l.pos += 2
+					l.emit(itemCompoundAssign)
+				case strings.HasPrefix(op, "append") && len(op) > len("append") && isSpace(rune(op[len("append")])):
+					l.pos += len("append")
+					l.emit(itemAppend)
+				default:
+					return l.errorf("no assignment found")
+				}
+				l.pushState(lexInsideAction)
 			}
 			break Loop
 		}
@@ -472,7 +526,7 @@ func lexSpace(l *lexer) stateFn {
 		numSpaces++
 	}
 
-	if isStateFnEqual(lexFn, lexInsideCondition) {
+	if isStateFnEqual(lexFn, lexInsideCondition) || isStateFnEqual(lexFn, lexExpression) {
 		if strings.HasPrefix(l.input[l.index][l.pos-1:], delim) {
 			l.backup() // Before the space.
 		}
@@ -499,15 +553,47 @@ func lexNumber(l *lexer) stateFn {
 	if !l.scanNumber() {
 		return l.errorf("bad number syntax: %q", l.input[l.index][l.start:l.pos])
 	}
+	if strings.ContainsRune(durationUnits, l.peek()) {
+		if !l.scanDuration() {
+			return l.errorf("bad duration syntax: %q", l.input[l.index][l.start:l.pos])
+		}
+		l.emit(itemDuration)
+		return lexInsideExpression
+	}
 	l.emit(itemNumber)
 	return lexInsideExpression
 }
 
+const durationUnits = "dhms"
+
+// scanDuration scans the units of a duration such as 1h30m, the leading
+// number has already been scanned.
+func (l *lexer) scanDuration() bool {
+	for l.accept(durationUnits) {
+		if !l.accept(decimalDigits) {
+			break
+		}
+		l.acceptRun(decimalDigits)
+		if l.accept(".") {
+			l.acceptRun(decimalDigits)
+		}
+	}
+	if isAlphaNumeric(l.peek()) {
+		l.next()
+		return false
+	}
+	return true
+}
+
+// decimalDigits are the digits of decimal numbers, Persian and Arabic-Indic
+// digits are accepted and normalized by the parser.
+const decimalDigits = "0123456789_۰۱۲۳۴۵۶۷۸۹٠١٢٣٤٥٦٧٨٩"
+
 func (l *lexer) scanNumber() bool {
 	// Optional leading sign.
 	l.accept("+-")
 	// Is it hex?
-	digits := "0123456789_"
+	digits := decimalDigits
 	if l.accept("0") {
 		// Note: Leading 0 does not mean octal in floats.
 		if l.accept("xX") {
@@ -522,16 +608,16 @@ func (l *lexer) scanNumber() bool {
 	if l.accept(".") {
 		l.acceptRun(digits)
 	}
-	if len(digits) == 10+1 && l.accept("eE") {
+	if digits == decimalDigits && l.accept("eE") {
 		l.accept("+-")
-		l.acceptRun("0123456789_")
+		l.acceptRun(decimalDigits)
 	}
 	if len(digits) == 16+6+1 && l.accept("pP") {
 		l.accept("+-")
 		l.acceptRun("0123456789_")
 	}
-	// Next thing mustn't be alphanumeric.
-	if isAlphaNumeric(l.peek()) {
+	// Next thing mustn't be alphanumeric, unless it is a duration unit.
+	if isAlphaNumeric(l.peek()) && !strings.ContainsRune(durationUnits, l.peek()) {
 		l.next()
 		return false
 	}
@@ -557,12 +643,66 @@ Loop:
 	return lexInsideExpression
 }
 
+// lexDate scans a date literal, the '@' has already been scanned. A 'j'
+// after the '@' starts a jalali date. A + or - right after the literal, as
+// in @2024-03-20+1d, is an operator unless it starts the zone offset of a
+// time.
+func lexDate(l *lexer) stateFn {
+	l.accept("j")
+	l.acceptRun(decimalDigits)
+	for i := 0; i < 2 && l.accept("-/"); i++ {
+		l.acceptRun(decimalDigits)
+	}
+	if l.accept("T") {
+		l.acceptRun(decimalDigits + ":.")
+		if !l.accept("Z") {
+			l.scanZoneOffset()
+		}
+	}
+	if isAlphaNumeric(l.peek()) {
+		l.next()
+		return l.errorf("bad date syntax: %q", l.input[l.index][l.start:l.pos])
+	}
+	l.emit(itemDate)
+	switch l.peek() {
+	case '+':
+		l.next()
+		l.emit(itemAdd)
+	case '-':
+		l.next()
+		l.emit(itemMinus)
+	}
+	return lexInsideExpression
+}
+
+// scanZoneOffset scans a zone offset such as +03:30.
+func (l *lexer) scanZoneOffset() {
+	s := l.input[l.index][l.pos:]
+	if len(s) < 6 || (s[0] != '+' && s[0] != '-') || s[3] != ':' {
+		return
+	}
+	for _, i := range []int{1, 2, 4, 5} {
+		if s[i] < '0' || s[i] > '9' {
+			return
+		}
+	}
+	l.pos += 6
+}
+
 func lexIdentifier(l *lexer) stateFn {
 Loop:
 	for {
 		switch r := l.next(); {
 		case isAlphaNumeric(r):
 			// absorb.
+		case r == '.' && isAlphaNumeric(l.peek()):
+			// absorb a path selector.
+		case r == '?' && l.peek() == '.':
+			// absorb an optional path selector.
+			l.next()
+			if !isAlphaNumeric(l.peek()) {
+				return l.errorf("bad path syntax: %q", l.input[l.index][l.start:l.pos])
+			}
 		default:
 			l.backup()
 			word := l.input[l.index][l.start:l.pos]
@@ -572,6 +712,8 @@ Loop:
 				return lexFunction
 			case word == "true", word == "false":
 				l.emit(itemBool)
+			case word == "null":
+				l.emit(itemNull)
 			default:
 				l.emit(itemIdentifier)
 			}
@@ -0,0 +1,91 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// lexValues returns the values of the tokens of the expressions of a rule,
+// or the error of the lexer.
+func lexValues(rule string) (string, error) {
+	l := lex([]string{rule})
+	defer l.drain()
+	var vals []string
+	for {
+		it := l.nextItem()
+		switch it.typ {
+		case itemEOF:
+			return strings.Join(vals, " "), nil
+		case itemError:
+			return "", errors.New(it.val)
+		case itemLeftRuleDelim, itemRightRuleDelim, itemLeftConditionDelim, itemRightConditionDelim,
+			itemLeftActionDelim, itemRightActionDelim:
+			continue
+		}
+		vals = append(vals, it.val)
+	}
+}
+
+func TestLexDates(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"d > @2024-03-20 | y = true", "d > @2024-03-20 y = true"},
+		{"d > @2024-03-20+1d | y = true", "d > @2024-03-20 + 1d y = true"},
+		{"d > @2024-03-20-1h30m | y = true", "d > @2024-03-20 - 1h30m y = true"},
+		{"d > @2024-03-20 + 1d | y = true", "d > @2024-03-20 + 1d y = true"},
+		{"d > @2024-03-20T10:00 | y = true", "d > @2024-03-20T10:00 y = true"},
+		{"d > @2024-03-20T10:00:30Z | y = true", "d > @2024-03-20T10:00:30Z y = true"},
+		{"d > @2024-03-20T10:00:00+03:30 | y = true", "d > @2024-03-20T10:00:00+03:30 y = true"},
+		{"d > @2024-03-20T10:00:00-05:00+1d | y = true", "d > @2024-03-20T10:00:00-05:00 + 1d y = true"},
+		{"d > @2024-03-20T10:00+1h | y = true", "d > @2024-03-20T10:00 + 1h y = true"},
+		{"d > @j1403/01/01-2d | y = true", "d > @j1403/01/01 - 2d y = true"},
+		{"at = @2024-03-20+wait", "at = @2024-03-20 + wait"},
+		{"at = max(@2024-03-20, @2024-03-21)", "at = max ( @2024-03-20 , @2024-03-21 )"},
+	} {
+		got, err := lexValues(c.in)
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q: tokens %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestLexDurations(t *testing.T) {
+	for _, c := range []struct {
+		in, want string
+	}{
+		{"wait > 14d | y = true", "wait > 14d y = true"},
+		{"wait > 1h30m | y = true", "wait > 1h30m y = true"},
+		{"wait > 1.5h | y = true", "wait > 1.5h y = true"},
+		{"n = 2d / 1h", "n = 2d / 1h"},
+		{"wait > ۲d | y = true", "wait > ۲d y = true"},
+	} {
+		got, err := lexValues(c.in)
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q: tokens %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	for in, want := range map[string]string{
+		"d > @2024-03-20x | y = true":         "bad date syntax",
+		"d > @2024-03-20T10:00+1x | y = true": "bad number syntax",
+		"wait > 1hx | y = true":               "bad duration syntax",
+		"wait > 1y | y = true":                "bad number syntax",
+	} {
+		_, err := lexValues(in)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: error %v, want %q", in, err, want)
+		}
+	}
+}
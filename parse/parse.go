@@ -2,9 +2,15 @@ package parse
 
 import (
 	"fmt"
+	"math"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/sazito/mosalat/jalali"
+	"github.com/sazito/mosalat/persian"
 )
 
 func Parse(input []string, funcMap, inputMap, outputMap map[string]interface{}) (AST, error) {
@@ -12,6 +18,22 @@ func Parse(input []string, funcMap, inputMap, outputMap map[string]interface{})
 	return parser.Parse()
 }
 
+// ParseSyntax parses rules without resolving their names, for tools that
+// only print or inspect them. Identifiers are not marked as inputs and
+// calls are not checked against functions, so the AST is not meant to be
+// evaluated.
+func ParseSyntax(input []string) (AST, error) {
+	parser := newParser(lex(input), nil, nil, nil)
+	parser.syntax = true
+	return parser.Parse()
+}
+
+// ParseExpression parses a single expression, such as the condition of a
+// rule, over the given maps.
+func ParseExpression(input string, funcMap, inputMap, outputMap map[string]interface{}) (*ExpressionNode, error) {
+	return newParser(lexExpr(input), funcMap, inputMap, outputMap).parseExpression()
+}
+
 type parser struct {
 	lex       *lexer
 	funcMap   map[string]interface{}
@@ -19,6 +41,7 @@ type parser struct {
 	outputMap map[string]interface{}
 	lookahead [2]item
 	peekCount int
+	syntax    bool // only check the syntax, see ParseSyntax
 }
 
 func newParser(lex *lexer, funcMap, inputMap, outputMap map[string]interface{}) *parser {
@@ -43,6 +66,18 @@ func (p *parser) Parse() (ast AST, err error) {
 	return
 }
 
+func (p *parser) parseExpression() (exp *ExpressionNode, err error) {
+	defer p.recover(&err)
+
+	n := p.expression()
+	if n.Expression == nil {
+		p.errorf("empty expression")
+	}
+	p.expect(itemEOF)
+
+	return n, nil
+}
+
 func (p *parser) nextToken() item {
 	return p.lex.nextItem()
 }
@@ -73,10 +108,23 @@ func (p *parser) peek() item {
 	return p.lookahead[0]
 }
 
+// Error is an error of the parser or the lexer, at the position of the
+// last token read.
+type Error struct {
+	Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return "parser: " + e.Msg
+}
+
 // errorf formats the error and terminates processing.
 func (p *parser) errorf(format string, args ...interface{}) {
-	format = fmt.Sprintf("parser: %s", format)
-	panic(fmt.Errorf(format, args...))
+	panic(&Error{
+		Position: p.lookahead[0].pos,
+		Msg:      fmt.Sprintf(format, args...),
+	})
 }
 
 // error terminates processing.
@@ -189,10 +237,16 @@ func (p *parser) assignment() *AssingmentNode {
 
 	p.outputMap[v.val] = true
 
-	p.expect(itemAssign)
+	op := p.next()
+	switch op.typ {
+	case itemAssign, itemCompoundAssign, itemAppend:
+	default:
+		p.unexpected(op, itemAssign, itemCompoundAssign, itemAppend)
+	}
 	exp := p.expression()
 	return &AssingmentNode{
 		Position: v.pos,
+		Operator: op.val,
 		Variable: &VariableNode{
 			Position:   v.pos,
 			Identifier: v.val,
@@ -210,7 +264,7 @@ func (p *parser) expression() *ExpressionNode {
 		case itemRightParen, itemRightConditionDelim, itemSeprator:
 			p.next()
 			return &n
-		case itemRightFunctionDelim, itemRightActionDelim:
+		case itemRightFunctionDelim, itemRightActionDelim, itemEOF:
 			return &n
 		case itemLeftParen:
 			p.next()
@@ -239,6 +293,24 @@ func (p *parser) expression() *ExpressionNode {
 			} else {
 				n.Expression = p.assignToNode(n.Expression, p.string())
 			}
+		case itemDuration:
+			if n.Expression == nil {
+				n.Expression = p.duration()
+			} else {
+				n.Expression = p.assignToNode(n.Expression, p.duration())
+			}
+		case itemDate:
+			if n.Expression == nil {
+				n.Expression = p.date()
+			} else {
+				n.Expression = p.assignToNode(n.Expression, p.date())
+			}
+		case itemNull:
+			if n.Expression == nil {
+				n.Expression = p.null()
+			} else {
+				n.Expression = p.assignToNode(n.Expression, p.null())
+			}
 		case itemFunction:
 			if n.Expression == nil {
 				n.Expression = p.function()
@@ -251,7 +323,7 @@ func (p *parser) expression() *ExpressionNode {
 			} else {
 				n.Expression = p.assignToNode(n.Expression, p.identifier())
 			}
-		case itemAdd, itemMinus, itemDiv, itemMod, itemPow:
+		case itemAdd, itemMinus, itemDiv, itemMod, itemPow, itemCoalesce:
 			if n.Expression == nil {
 				p.unexpected(p.peek())
 			} else {
@@ -275,7 +347,7 @@ func (p *parser) expressionAfterCondition() Node {
 		switch p.peek().typ {
 		case itemRightParen, itemRightConditionDelim, itemSeprator:
 			return n
-		case itemRightFunctionDelim, itemRightActionDelim:
+		case itemRightFunctionDelim, itemRightActionDelim, itemEOF:
 			return n
 		case itemLeftParen:
 			p.next()
@@ -304,6 +376,24 @@ func (p *parser) expressionAfterCondition() Node {
 			} else {
 				n = p.assignToNode(n, p.string())
 			}
+		case itemDuration:
+			if n == nil {
+				n = p.duration()
+			} else {
+				n = p.assignToNode(n, p.duration())
+			}
+		case itemDate:
+			if n == nil {
+				n = p.date()
+			} else {
+				n = p.assignToNode(n, p.date())
+			}
+		case itemNull:
+			if n == nil {
+				n = p.null()
+			} else {
+				n = p.assignToNode(n, p.null())
+			}
 		case itemFunction:
 			if n == nil {
 				n = p.function()
@@ -322,7 +412,7 @@ func (p *parser) expressionAfterCondition() Node {
 			} else {
 				n = p.addToPrivNode(n, p.math())
 			}
-		case itemAnd, itemOr, itemEquals, itemGreaterEquals, itemLowerEquals, itemLowers, itemGreaters, itemNotEquals:
+		case itemCoalesce, itemAnd, itemOr, itemEquals, itemGreaterEquals, itemLowerEquals, itemLowers, itemGreaters, itemNotEquals:
 			return n
 		default:
 			p.unexpected(p.peek())
@@ -333,7 +423,7 @@ func (p *parser) expressionAfterCondition() Node {
 func (p *parser) expWithoutDepth() Node {
 	var n Node
 	switch p.peek().typ {
-	case itemRightParen, itemRightConditionDelim, itemRightActionDelim, itemSeprator, itemRightFunctionDelim:
+	case itemRightParen, itemRightConditionDelim, itemRightActionDelim, itemSeprator, itemRightFunctionDelim, itemEOF:
 	case itemNot:
 		n = p.not()
 	case itemNumber:
@@ -342,11 +432,17 @@ func (p *parser) expWithoutDepth() Node {
 		n = p.bool()
 	case itemString:
 		n = p.string()
+	case itemDuration:
+		n = p.duration()
+	case itemDate:
+		n = p.date()
+	case itemNull:
+		n = p.null()
 	case itemFunction:
 		n = p.function()
 	case itemIdentifier:
 		n = p.identifier()
-	case itemAdd, itemMinus, itemDiv, itemMod, itemPow:
+	case itemAdd, itemMinus, itemDiv, itemMod, itemPow, itemCoalesce:
 	case itemAnd, itemOr, itemEquals, itemGreaterEquals, itemLowerEquals, itemLowers, itemGreaters, itemNotEquals:
 	default:
 		p.unexpected(p.peek())
@@ -383,7 +479,7 @@ func (p *parser) addToPrivNode(parent, new Node) Node {
 	switch parent.(type) {
 	case *MathExpressionNode, *ConditionalExpressionNode:
 		n = mergeExp(parent, new)
-	case *NotNode, *NumberNode, *BoolNode, *StringNode, *FunctionNode, *IdentifierNode, *ExpressionNode:
+	case *NotNode, *NumberNode, *BoolNode, *StringNode, *DurationNode, *DateNode, *NullNode, *ExistsNode, *FunctionNode, *IdentifierNode, *ExpressionNode:
 		n = assignLeftExp(parent, new)
 	}
 	return n
@@ -402,6 +498,15 @@ func assignLeftExp(parent, new Node) Node {
 func mergeExp(parent, new Node) Node {
 	switch n := parent.(type) {
 	case *MathExpressionNode:
+		// ?? binds looser than every other operator.
+		if nn, ok := new.(*MathExpressionNode); ok && nn.IsCoalesce {
+			nn.LeftExpression = n
+			return new
+		}
+		if n.IsCoalesce {
+			n.RightExpression = mergeOperand(n.RightExpression, new)
+			return parent
+		}
 		switch nn := new.(type) {
 		case *MathExpressionNode:
 			if nn.IsMod {
@@ -431,6 +536,10 @@ func mergeExp(parent, new Node) Node {
 	case *ConditionalExpressionNode:
 		switch nn := new.(type) {
 		case *MathExpressionNode:
+			if nn.IsCoalesce {
+				nn.LeftExpression = n
+				return new
+			}
 			nn.LeftExpression = n.RightExpression
 			n.RightExpression = nn
 			return parent
@@ -447,6 +556,16 @@ func mergeExp(parent, new Node) Node {
 	return parent
 }
 
+// mergeOperand merges new into the operand of an operator, which is either
+// an operator itself or a single value.
+func mergeOperand(operand, new Node) Node {
+	switch operand.(type) {
+	case *MathExpressionNode, *ConditionalExpressionNode:
+		return mergeExp(operand, new)
+	}
+	return assignLeftExp(operand, new)
+}
+
 func (p *parser) not() *NotNode {
 	v := p.expect(itemNot)
 	exp := p.expCall()
@@ -458,6 +577,7 @@ func (p *parser) not() *NotNode {
 
 func (p *parser) number() *NumberNode {
 	v := p.expect(itemNumber)
+	v.val = persian.Digits(v.val)
 	n := NumberNode{
 		Position: v.pos,
 		Text:     v.val,
@@ -532,42 +652,126 @@ func (p *parser) string() *StringNode {
 	}
 }
 
+var durationUnitValues = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'h': time.Hour,
+	'm': time.Minute,
+	's': time.Second,
+}
+
+func (p *parser) duration() *DurationNode {
+	v := p.expect(itemDuration)
+	v.val = persian.Digits(v.val)
+	var d time.Duration
+	text := strings.Replace(v.val, "_", "", -1)
+	for len(text) > 0 {
+		i := strings.IndexAny(text, durationUnits)
+		if i < 0 {
+			p.error(fmt.Errorf("illegal duration syntax: %q", v.val))
+		}
+		f, err := strconv.ParseFloat(text[:i], 64)
+		if err != nil {
+			p.error(fmt.Errorf("illegal duration syntax: %q", v.val))
+		}
+		part := f * float64(durationUnitValues[text[i]])
+		if math.Abs(float64(d)+part) > math.MaxInt64 {
+			p.error(fmt.Errorf("duration overflow: %q", v.val))
+		}
+		d += time.Duration(part)
+		text = text[i+1:]
+	}
+	return &DurationNode{
+		Position: v.pos,
+		Duration: d,
+		Text:     v.val,
+	}
+}
+
+// dateLayouts are the accepted layouts of date literals, dates without a
+// zone are in UTC.
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+}
+
+func (p *parser) date() *DateNode {
+	v := p.expect(itemDate)
+	v.val = persian.Digits(v.val)
+	text := v.val[1:]
+	if strings.HasPrefix(text, "j") {
+		text = p.jalaliToGregorian(v)
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return &DateNode{
+				Position: v.pos,
+				Time:     t,
+				Text:     v.val,
+			}
+		}
+	}
+	p.error(fmt.Errorf("illegal date syntax: %q", v.val))
+	return nil
+}
+
+// jalaliToGregorian rewrites the date part of a jalali date literal such as
+// @j1403/01/15T10:00 to its gregorian date.
+func (p *parser) jalaliToGregorian(v item) string {
+	text := v.val[2:]
+	rest := ""
+	if i := strings.IndexByte(text, 'T'); i >= 0 {
+		text, rest = text[:i], text[i:]
+	}
+	parts := strings.FieldsFunc(text, func(r rune) bool { return r == '-' || r == '/' })
+	if len(parts) != 3 {
+		p.error(fmt.Errorf("illegal date syntax: %q", v.val))
+	}
+	var ymd [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			p.error(fmt.Errorf("illegal date syntax: %q", v.val))
+		}
+		ymd[i] = n
+	}
+	t, err := jalali.Date(ymd[0], ymd[1], ymd[2], 0, 0, 0, time.UTC)
+	if err != nil {
+		p.error(err)
+	}
+	return t.Format("2006-01-02") + rest
+}
+
 func (p *parser) math() *MathExpressionNode {
 	n := p.next()
 	exp := p.expCall()
-	return &MathExpressionNode{
-		IsMod:           n.typ == itemMod,
-		IsAditive:       n.typ == itemMinus || n.typ == itemAdd,
-		IsProductive:    n.typ == itemPow || n.typ == itemDiv,
-		Position:        n.pos,
-		Identifier:      n.val,
-		Type:            n.typ,
-		RightExpression: exp,
-	}
+	m := newMathExpressionNode(n.pos, n.typ, n.val)
+	m.RightExpression = exp
+	return m
 }
 
 func (p *parser) conditional() *ConditionalExpressionNode {
 	n := p.next()
 	exp := p.expressionAfterCondition()
-	return &ConditionalExpressionNode{
-		IsBooleanBase:   n.typ == itemOr || n.typ == itemAnd,
-		IsDiffBase:      n.typ == itemEquals || n.typ == itemNotEquals || n.typ == itemGreaterEquals || n.typ == itemLowerEquals || n.typ == itemGreaters || n.typ == itemLowers,
-		Position:        n.pos,
-		Identifier:      n.val,
-		Type:            n.typ,
-		RightExpression: exp,
-	}
+	c := newConditionalExpressionNode(n.pos, n.typ, n.val)
+	c.RightExpression = exp
+	return c
 }
 
-func (p *parser) function() *FunctionNode {
+func (p *parser) function() Node {
 	v := p.expect(itemFunction)
-	if _, ok := p.funcMap[v.val]; !ok {
+	if v.val == "exists" {
+		return p.exists(v)
+	}
+	if _, ok := p.funcMap[v.val]; !ok && !p.syntax {
 		p.unexpected(v)
 	}
 	if _, ok := p.inputMap[v.val]; ok {
 		p.unexpected(v)
 	}
-	if _, ok := p.outputMap[v.val]; ok {
+	if _, ok := p.outputMap[v.val]; ok && !p.syntax {
 		p.unexpected(v)
 	}
 
@@ -580,6 +784,9 @@ func (p *parser) function() *FunctionNode {
 		switch p.peek().typ {
 		case itemRightFunctionDelim:
 			p.next()
+			if !p.syntax {
+				p.validateCall(v, &n)
+			}
 			return &n
 		default:
 			n.Args = append(n.Args, *p.expression())
@@ -587,13 +794,129 @@ func (p *parser) function() *FunctionNode {
 	}
 }
 
+// CheckCall checks a call with nargs arguments to the function fn of
+// funcMap: the number of arguments against its go signature, variadic
+// functions accept any number of trailing arguments, and that it returns a
+// value, or a value and an error. The parser checks every call, and the
+// evaluator checks them again against the functions it is given.
+func CheckCall(name string, fn interface{}, nargs int) error {
+	ft := reflect.TypeOf(fn)
+	if ft == nil || ft.Kind() != reflect.Func {
+		return fmt.Errorf("%s is not a function", name)
+	}
+	if (ft.IsVariadic() && nargs < ft.NumIn()-1) || (!ft.IsVariadic() && nargs != ft.NumIn()) {
+		return fmt.Errorf("function %s expects %s, called with %d arguments", name, ft, nargs)
+	}
+	if ft.NumOut() == 0 || ft.NumOut() > 2 || (ft.NumOut() == 2 && ft.Out(1) != errorType) {
+		return fmt.Errorf("function %s %s must return a value, or a value and an error", name, ft)
+	}
+	return nil
+}
+
+// validateCall checks a call with CheckCall and that its literal arguments
+// are assignable to their parameters.
+func (p *parser) validateCall(tok item, n *FunctionNode) {
+	fn := p.funcMap[n.Function]
+	if err := CheckCall(n.Function, fn, len(n.Args)); err != nil {
+		p.errorf("%s at line %d char %d", err, tok.pos.Index, tok.pos.Char)
+	}
+	ft := reflect.TypeOf(fn)
+	for i, arg := range n.Args {
+		pt := paramType(ft, i)
+		if !literalAssignable(arg.Expression, pt) {
+			p.errorf("cannot use %s as %s in argument %d of %s %s at line %d char %d", literalText(arg.Expression), pt, i+1, n.Function, ft, arg.Index, arg.Char)
+		}
+	}
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func paramType(ft reflect.Type, i int) reflect.Type {
+	if ft.IsVariadic() && i >= ft.NumIn()-1 {
+		return ft.In(ft.NumIn() - 1).Elem()
+	}
+	return ft.In(i)
+}
+
+// literalAssignable reports whether node, if it is a literal, can be
+// converted to t. Number literals convert to any numeric type they fit in
+// exactly.
+func literalAssignable(node Node, t reflect.Type) bool {
+	switch n := node.(type) {
+	case *NumberNode:
+		v := reflect.New(t).Elem()
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return n.IsInt && !v.OverflowInt(n.Int64)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return n.IsUint && !v.OverflowUint(n.Uint64)
+		case reflect.Float32, reflect.Float64:
+			return !v.OverflowFloat(n.Float64)
+		}
+		return reflect.TypeOf(n.Float64).AssignableTo(t)
+	case *StringNode:
+		return t.Kind() == reflect.String || reflect.TypeOf(n.Text).AssignableTo(t)
+	case *BoolNode:
+		return t.Kind() == reflect.Bool || reflect.TypeOf(n.IsTrue).AssignableTo(t)
+	case *DurationNode:
+		return reflect.TypeOf(n.Duration).AssignableTo(t)
+	case *DateNode:
+		return reflect.TypeOf(n.Time).AssignableTo(t)
+	}
+	return true
+}
+
+func literalText(node Node) string {
+	switch n := node.(type) {
+	case *NumberNode:
+		return n.Text
+	case *StringNode:
+		return n.RawText
+	case *BoolNode:
+		return fmt.Sprint(n.IsTrue)
+	case *DurationNode:
+		return n.Text
+	case *DateNode:
+		return n.Text
+	}
+	return ""
+}
+
+// exists parses the exists(x) builtin, it takes precedence over a function
+// with the same name in funcMap.
+func (p *parser) exists(v item) *ExistsNode {
+	p.expect(itemLeftFunctionDelim)
+	arg := p.expression()
+	id, ok := arg.Expression.(*IdentifierNode)
+	if !ok {
+		p.errorf("exists expects an identifier at line %d char %d", v.pos.Index, v.pos.Char)
+	}
+	p.expect(itemRightFunctionDelim)
+	return &ExistsNode{
+		Position:   v.pos,
+		Identifier: id,
+	}
+}
+
+func (p *parser) null() *NullNode {
+	v := p.expect(itemNull)
+	return &NullNode{
+		Position: v.pos,
+	}
+}
+
 func (p *parser) identifier() *IdentifierNode {
 	v := p.expect(itemIdentifier)
+	var path []Selector
+	if i := strings.IndexAny(v.val, ".?"); i >= 0 {
+		path = parsePath(v.val[i:])
+		v.val = v.val[:i]
+	}
 
 	_, okO := p.outputMap[v.val]
 	_, okI := p.inputMap[v.val]
 	_, okF := p.funcMap[v.val]
-	if !okI && !okO {
+	if !okI && !okO && !p.syntax {
 		p.unexpected(v)
 	}
 	if okI && okO {
@@ -606,5 +929,27 @@ func (p *parser) identifier() *IdentifierNode {
 		Position:   v.pos,
 		Identifier: v.val,
 		IsInput:    okI,
+		Path:       path,
+	}
+}
+
+// parsePath parses selectors such as .address?.city
+func parsePath(s string) []Selector {
+	var path []Selector
+	for len(s) > 0 {
+		sel := Selector{}
+		if strings.HasPrefix(s, "?") {
+			sel.Optional = true
+			s = s[1:]
+		}
+		s = s[1:]
+		i := strings.IndexAny(s, ".?")
+		if i < 0 {
+			i = len(s)
+		}
+		sel.Name = s[:i]
+		s = s[i:]
+		path = append(path, sel)
 	}
+	return path
 }
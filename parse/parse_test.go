@@ -0,0 +1,284 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testInputMap = map[string]interface{}{
+	"d":     time.Time{},
+	"wait":  time.Duration(0),
+	"total": float64(0),
+	"x":     float64(0),
+}
+
+var testOutputMap = map[string]interface{}{"y": false, "at": time.Time{}, "n": float64(0)}
+
+// parseCondition parses rule and returns the tree of its condition.
+func parseCondition(t *testing.T, rule string) Node {
+	t.Helper()
+	ast, err := Parse([]string{rule}, nil, testInputMap, testOutputMap)
+	if err != nil {
+		t.Fatalf("%q: %v", rule, err)
+	}
+	return ast.Node.(*EngineNode).Rules[0].Condition.Expression
+}
+
+func TestJalaliDateLiterals(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"@j1403/01/01", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"@j1404/01/01", time.Date(2025, 3, 21, 0, 0, 0, 0, time.UTC)},
+		{"@j1403-01-15", time.Date(2024, 4, 3, 0, 0, 0, 0, time.UTC)},
+		{"@j1399/12/30", time.Date(2021, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"@j1403/12/30T10:00", time.Date(2025, 3, 20, 10, 0, 0, 0, time.UTC)},
+		{"@j۱۴۰۳/۰۱/۰۱", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)},
+	} {
+		n, ok := parseCondition(t, "d > "+c.in+" | y = true").(*ConditionalExpressionNode)
+		if !ok {
+			t.Errorf("%s: condition is not a comparison", c.in)
+			continue
+		}
+		date, ok := n.RightExpression.(*DateNode)
+		if !ok {
+			t.Errorf("%s: right operand is %T, not a date", c.in, n.RightExpression)
+			continue
+		}
+		if !date.Time.Equal(c.want) {
+			t.Errorf("%s = %s, want %s", c.in, date.Time, c.want)
+		}
+	}
+}
+
+func TestJalaliDateLiteralErrors(t *testing.T) {
+	for in, want := range map[string]string{
+		"@j1404/12/30": "invalid jalali date 1404/12/30",
+		"@j1403/13/01": "invalid jalali date 1403/13/01",
+		"@j1403/01":    "illegal date syntax",
+		"@j0/01/01":    "jalali year 0 out of range",
+	} {
+		_, err := Parse([]string{"d > " + in + " | y = true"}, nil, testInputMap, testOutputMap)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", in, err, want)
+		}
+	}
+}
+
+func TestDateLiterals(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"@2024-03-20", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{"@2024-03-20T10:30", time.Date(2024, 3, 20, 10, 30, 0, 0, time.UTC)},
+		{"@2024-03-20T10:30Z", time.Date(2024, 3, 20, 10, 30, 0, 0, time.UTC)},
+		{"@2024-03-20T10:30+03:30", time.Date(2024, 3, 20, 7, 0, 0, 0, time.UTC)},
+		{"@2024-03-20T10:30-05:00", time.Date(2024, 3, 20, 15, 30, 0, 0, time.UTC)},
+		{"@2024-03-20T10:30:15", time.Date(2024, 3, 20, 10, 30, 15, 0, time.UTC)},
+		{"@2024-03-20T10:30:15.5", time.Date(2024, 3, 20, 10, 30, 15, 5e8, time.UTC)},
+		{"@2024-03-20T10:30:15Z", time.Date(2024, 3, 20, 10, 30, 15, 0, time.UTC)},
+		{"@2024-03-20T10:30:15+03:30", time.Date(2024, 3, 20, 7, 0, 15, 0, time.UTC)},
+		{"@2024-03-20T10:30:15-05:00", time.Date(2024, 3, 20, 15, 30, 15, 0, time.UTC)},
+	} {
+		n, ok := parseCondition(t, "d > "+c.in+" | y = true").(*ConditionalExpressionNode)
+		if !ok {
+			t.Errorf("%s: condition is not a comparison", c.in)
+			continue
+		}
+		date, ok := n.RightExpression.(*DateNode)
+		if !ok {
+			t.Errorf("%s: right operand is %T, not a date", c.in, n.RightExpression)
+			continue
+		}
+		if !date.Time.Equal(c.want) || date.Text != c.in {
+			t.Errorf("%s = %s %q, want %s", c.in, date.Time, date.Text, c.want)
+		}
+	}
+	for _, in := range []string{"@2024-13-01", "@2024-03", "@2024-03-20T25:00"} {
+		if _, err := Parse([]string{"d > " + in + " | y = true"}, nil, testInputMap, testOutputMap); err == nil {
+			t.Errorf("%s: no error", in)
+		}
+	}
+}
+
+func TestDurationLiterals(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"14d":   14 * 24 * time.Hour,
+		"3h":    3 * time.Hour,
+		"30m":   30 * time.Minute,
+		"10s":   10 * time.Second,
+		"1h30m": 90 * time.Minute,
+		"1.5h":  90 * time.Minute,
+		"۲d":    48 * time.Hour,
+	} {
+		n, ok := parseCondition(t, "wait > "+in+" | y = true").(*ConditionalExpressionNode)
+		if !ok {
+			t.Errorf("%s: condition is not a comparison", in)
+			continue
+		}
+		d, ok := n.RightExpression.(*DurationNode)
+		if !ok {
+			t.Errorf("%s: right operand is %T, not a duration", in, n.RightExpression)
+			continue
+		}
+		if d.Duration != want {
+			t.Errorf("%s = %s, want %s", in, d.Duration, want)
+		}
+	}
+}
+
+func TestDateArithmetic(t *testing.T) {
+	for _, in := range []string{
+		"d > @2024-03-20+1d",
+		"d > @2024-03-20 + 1d",
+		"d > @2024-03-20T10:00:00+03:30+1d",
+	} {
+		n, ok := parseCondition(t, in+" | y = true").(*ConditionalExpressionNode)
+		if !ok {
+			t.Errorf("%s: condition is not a comparison", in)
+			continue
+		}
+		m, ok := n.RightExpression.(*MathExpressionNode)
+		if !ok || m.Identifier != "+" {
+			t.Errorf("%s: right operand is %T, not an addition", in, n.RightExpression)
+			continue
+		}
+		if _, ok := m.LeftExpression.(*DateNode); !ok {
+			t.Errorf("%s: left of + is %T, not a date", in, m.LeftExpression)
+		}
+		if _, ok := m.RightExpression.(*DurationNode); !ok {
+			t.Errorf("%s: right of + is %T, not a duration", in, m.RightExpression)
+		}
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	for _, rules := range [][]string{
+		{"y = true", "n = 1", "unknown > 1 | y = true"},
+		{"y = true", "n = 1", "x > 1 | = 1"},
+		{"y = true", "n = 1", "x > 1x | y = true"},
+	} {
+		_, err := Parse(rules, nil, testInputMap, testOutputMap)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%q: error %v is not an *Error", rules, err)
+			continue
+		}
+		if e.Index != 2 {
+			t.Errorf("%q: error %v in rule %d, want 2", rules, err, e.Index)
+		}
+		if !strings.HasPrefix(e.Error(), "parser: ") {
+			t.Errorf("%q: error %q", rules, err)
+		}
+	}
+}
+
+// An expression parses to the same tree as the condition of a rule.
+func TestParseExpression(t *testing.T) {
+	for _, expr := range []string{
+		"x",
+		"x > 1 && !(total < 2)",
+		"(x + 1) * 2 > total ?? 0",
+		"d + 1h > @2024-03-20",
+		`x == null || "a" != "b"`,
+		`x > 1 && "a | b" != "c"`,
+	} {
+		got, err := ParseExpression(expr, nil, testInputMap, testOutputMap)
+		if err != nil {
+			t.Errorf("%q: %v", expr, err)
+			continue
+		}
+		if want := parseCondition(t, expr+" | y = true"); !reflect.DeepEqual(got.Expression, want) {
+			t.Errorf("%q = %#v, want %#v", expr, got.Expression, want)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for expr, want := range map[string]string{
+		"":                      "empty expression",
+		"(x > 1":                "unclosed left paren",
+		"x > 1)":                "unexpected right paren",
+		"x, 1":                  "unrecognized character in expression",
+		"x > 1 | y = true":      "is a rule, not an expression",
+		`"a" != "b" | y = true`: "is a rule, not an expression",
+		"n = 1":                 "unexpected token",
+		"unknown > 1":           "unknown",
+	} {
+		_, err := ParseExpression(expr, nil, testInputMap, testOutputMap)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: error %v, want %q", expr, err, want)
+		}
+	}
+}
+
+var callFuncMap = map[string]interface{}{
+	"one":     func(n float64) float64 { return n },
+	"small":   func(n int8) int8 { return n },
+	"count":   func(n uint) uint { return n },
+	"label":   func(s string, n ...float64) string { return s },
+	"safe":    func(n float64) (float64, error) { return n, nil },
+	"span":    func(d time.Duration) time.Duration { return d },
+	"after":   func(t time.Time) bool { return true },
+	"nothing": func(n float64) {},
+	"pair":    func() (float64, float64) { return 0, 0 },
+	"three":   func() (float64, float64, error) { return 0, 0, nil },
+	"value":   1.0,
+}
+
+func TestCalls(t *testing.T) {
+	for _, c := range []struct {
+		call string
+		err  string
+	}{
+		{"one(1)", ""},
+		{"one(x)", ""},
+		{"one()", "function one expects func(float64) float64, called with 0 arguments"},
+		{"one(1, 2)", "called with 2 arguments"},
+		{"label(\"a\")", ""},
+		{"label(\"a\", 1, 2, 3)", ""},
+		{"label()", "function label expects func(string, ...float64) string, called with 0 arguments"},
+		{"label(\"a\", \"b\")", "cannot use \"b\" as float64 in argument 2 of label"},
+		{"label(1)", "cannot use 1 as string in argument 1 of label"},
+		{"safe(1)", ""},
+		{"one(\"a\")", "cannot use \"a\" as float64 in argument 1 of one"},
+		{"one(true)", "cannot use true as float64"},
+		{"small(127)", ""},
+		{"small(128)", "cannot use 128 as int8"},
+		{"small(1.5)", "cannot use 1.5 as int8"},
+		{"count(-1)", "cannot use -1 as uint"},
+		{"span(1h)", ""},
+		{"span(1.5)", "cannot use 1.5 as time.Duration"},
+		{"after(@2024-03-20)", ""},
+		{"after(1h)", "cannot use 1h as time.Time"},
+		{"nothing(1)", "must return a value, or a value and an error"},
+		{"pair()", "must return a value, or a value and an error"},
+		{"three()", "must return a value, or a value and an error"},
+		{"value(1)", "value is not a function"},
+	} {
+		_, err := Parse([]string{"n = " + c.call}, callFuncMap, testInputMap, testOutputMap)
+		switch {
+		case c.err == "" && err != nil:
+			t.Errorf("%s: %v", c.call, err)
+		case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+			t.Errorf("%s: error %v, want %q", c.call, err, c.err)
+		}
+	}
+}
+
+func TestCheckCall(t *testing.T) {
+	for name, nargs := range map[string]int{"one": 1, "label": 1, "safe": 1} {
+		if err := CheckCall(name, callFuncMap[name], nargs); err != nil {
+			t.Errorf("CheckCall(%s, %d): %v", name, nargs, err)
+		}
+	}
+	for name, nargs := range map[string]int{"one": 2, "label": 0, "nothing": 1, "pair": 0, "value": 0, "missing": 0} {
+		if err := CheckCall(name, callFuncMap[name], nargs); err == nil {
+			t.Errorf("CheckCall(%s, %d): no error", name, nargs)
+		}
+	}
+}
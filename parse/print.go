@@ -0,0 +1,401 @@
+package parse
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Print returns the canonical source of the rules of the AST, one string per
+// rule as Parse takes them. Operators and commas are followed by a single
+// space, string literals keep their escapes and only the parentheses the
+// parser needs to build the same tree are written.
+func Print(ast AST) []string {
+	var rules []RuleNode
+	switch n := ast.Node.(type) {
+	case *EngineNode:
+		if n != nil {
+			rules = n.Rules
+		}
+	case EngineNode:
+		rules = n.Rules
+	}
+	s := make([]string, len(rules))
+	for i := range rules {
+		s[i] = printRule(&rules[i])
+	}
+	return s
+}
+
+func printRule(n *RuleNode) string {
+	actions := make([]string, len(n.Actions))
+	for i := range n.Actions {
+		actions[i] = printAction(&n.Actions[i])
+	}
+	s := strings.Join(actions, ", ")
+	if n.Condition != nil {
+		s = printExpression(n.Condition) + delim + s
+	}
+	return s
+}
+
+func printAction(n *AssingmentNode) string {
+	op := n.Operator
+	if op == "" {
+		op = "="
+	}
+	name := ""
+	if n.Variable != nil {
+		name = n.Variable.Identifier
+	}
+	return name + " " + op + " " + printExpression(n.RightExpression)
+}
+
+func printExpression(n Node) string {
+	return build(n).String()
+}
+
+// layout is an expression as the parser reads it: operands joined by binary
+// operators, where a parenthesized expression is an operand.
+type layout struct {
+	node        Node
+	op          string // empty for an operand
+	left, right *layout
+	text        string // source of an operand
+}
+
+func (l *layout) String() string {
+	if l.op == "" {
+		return l.text
+	}
+	return l.left.String() + " " + l.op + " " + l.right.String()
+}
+
+// build returns the layout of n with the fewest parentheses it finds. It
+// starts without any and, as long as the parser would build another tree,
+// puts the smallest subexpression the parser splits differently in
+// parentheses.
+func build(n Node) *layout {
+	l := flat(n)
+	for {
+		m := mismatch(l)
+		if m == nil {
+			return l
+		}
+		*m = layout{node: m.node, text: "(" + build(m.node).String() + ")"}
+	}
+}
+
+// flat returns the layout of n without parentheses.
+func flat(n Node) *layout {
+	switch u := unwrap(n).(type) {
+	case *MathExpressionNode:
+		return &layout{node: u, op: u.Identifier, left: flat(u.LeftExpression), right: flat(u.RightExpression)}
+	case *ConditionalExpressionNode:
+		return &layout{node: u, op: u.Identifier, left: flat(u.LeftExpression), right: flat(u.RightExpression)}
+	case nil:
+		return &layout{}
+	default:
+		return &layout{node: u, text: printOperand(u)}
+	}
+}
+
+// span is the range of operands of a layout under an operator.
+type span struct{ first, last int }
+
+// mismatch runs the operators of a layout through the merging of the parser
+// and returns the smallest operator of the layout whose operands the parser
+// does not group the same way, nil if it builds the same tree.
+func mismatch(l *layout) *layout {
+	var operands []Node
+	var ops []string
+	var walk func(l *layout)
+	walk = func(l *layout) {
+		if l.op == "" {
+			operands = append(operands, &NullNode{})
+			return
+		}
+		walk(l.left)
+		ops = append(ops, l.op)
+		walk(l.right)
+	}
+	walk(l)
+	top := operands[0]
+	for i := 0; i < len(ops); i++ {
+		if typ, ok := mathOperators[ops[i]]; ok {
+			m := newMathExpressionNode(Position{}, typ, ops[i])
+			m.RightExpression = operands[i+1]
+			top = mergeOperand(top, m)
+			continue
+		}
+		// The right operand of a comparison is the chain of arithmetic
+		// operators up to the next comparison or ??.
+		c := newConditionalExpressionNode(Position{}, conditionalOperators[ops[i]], ops[i])
+		right := operands[i+1]
+		for i+1 < len(ops) {
+			typ, ok := mathOperators[ops[i+1]]
+			if !ok || typ == itemCoalesce {
+				break
+			}
+			i++
+			m := newMathExpressionNode(Position{}, typ, ops[i])
+			m.RightExpression = operands[i+1]
+			right = mergeOperand(right, m)
+		}
+		c.RightExpression = right
+		top = mergeOperand(top, c)
+	}
+
+	index := make(map[Node]int, len(operands))
+	for i, o := range operands {
+		index[o] = i
+	}
+	built := map[span]bool{}
+	var spans func(n Node) span
+	spans = func(n Node) span {
+		var left, right Node
+		switch n := n.(type) {
+		case *MathExpressionNode:
+			left, right = n.LeftExpression, n.RightExpression
+		case *ConditionalExpressionNode:
+			left, right = n.LeftExpression, n.RightExpression
+		default:
+			i := index[n]
+			return span{i, i}
+		}
+		s := span{spans(left).first, spans(right).last}
+		built[s] = true
+		return s
+	}
+	spans(top)
+
+	var found *layout
+	size := 0
+	next := 0
+	var check func(l *layout) span
+	check = func(l *layout) span {
+		if l.op == "" {
+			next++
+			return span{next - 1, next - 1}
+		}
+		s := span{check(l.left).first, check(l.right).last}
+		if !built[s] && (found == nil || s.last-s.first < size) {
+			found, size = l, s.last-s.first
+		}
+		return s
+	}
+	check(l)
+	return found
+}
+
+func printOperand(n Node) string {
+	switch n := n.(type) {
+	case *NumberNode:
+		if n.Text != "" {
+			return n.Text
+		}
+		switch {
+		case n.IsInt:
+			return strconv.FormatInt(n.Int64, 10)
+		case n.IsUint:
+			return strconv.FormatUint(n.Uint64, 10)
+		}
+		return strconv.FormatFloat(n.Float64, 'g', -1, 64)
+	case *StringNode:
+		if n.RawText != "" {
+			return n.RawText
+		}
+		return strconv.Quote(n.Text)
+	case *BoolNode:
+		return strconv.FormatBool(n.IsTrue)
+	case *DurationNode:
+		if n.Text != "" {
+			return n.Text
+		}
+		return strconv.FormatFloat(n.Duration.Seconds(), 'f', -1, 64) + "s"
+	case *DateNode:
+		if n.Text != "" {
+			return n.Text
+		}
+		return "@" + n.Time.Format(time.RFC3339)
+	case *NullNode:
+		return "null"
+	case *IdentifierNode:
+		return printIdentifier(n)
+	case *VariableNode:
+		return n.Identifier
+	case *ExistsNode:
+		if n.Identifier == nil {
+			return "exists()"
+		}
+		return "exists(" + printIdentifier(n.Identifier) + ")"
+	case *FunctionNode:
+		args := make([]string, len(n.Args))
+		for i := range n.Args {
+			args[i] = printExpression(&n.Args[i])
+		}
+		return n.Function + "(" + strings.Join(args, ", ") + ")"
+	case *NotNode:
+		// The lexer only reads ! before a name, a number or a parenthesis.
+		l := build(n.Expression)
+		s := l.String()
+		if l.op != "" {
+			s = "(" + s + ")"
+		}
+		if r, _ := utf8.DecodeRuneInString(s); !isAlphaNumeric(r) && r != '(' {
+			s = "(" + s + ")"
+		}
+		return "!" + s
+	}
+	return ""
+}
+
+func printIdentifier(n *IdentifierNode) string {
+	s := n.Identifier
+	for _, sel := range n.Path {
+		s += sel.String()
+	}
+	return s
+}
+
+// unwrap returns the pointer form of a node, without the expression nodes
+// parentheses leave around it.
+func unwrap(n Node) Node {
+	for {
+		n = pointerOf(n)
+		e, ok := n.(*ExpressionNode)
+		if !ok {
+			return n
+		}
+		n = e.Expression
+	}
+}
+
+// pointerOf returns the pointer form of a node, nil for a nil node.
+func pointerOf(n Node) Node {
+	if n == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(n); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		return n
+	}
+	p := reflect.New(reflect.TypeOf(n))
+	p.Elem().Set(reflect.ValueOf(n))
+	return p.Interface().(Node)
+}
+
+// Equal reports whether two ASTs have the same structure. Positions,
+// parentheses and whether nodes are pointers or values are ignored.
+func Equal(a, b AST) bool {
+	return equalNode(a.Node, b.Node)
+}
+
+func equalNode(a, b Node) bool {
+	a, b = unwrap(a), unwrap(b)
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch a := a.(type) {
+	case *EngineNode:
+		b, ok := b.(*EngineNode)
+		if !ok || len(a.Rules) != len(b.Rules) {
+			return false
+		}
+		for i := range a.Rules {
+			if !equalNode(&a.Rules[i], &b.Rules[i]) {
+				return false
+			}
+		}
+		return true
+	case *RuleNode:
+		b, ok := b.(*RuleNode)
+		if !ok || len(a.Actions) != len(b.Actions) || !equalNode(a.Condition, b.Condition) {
+			return false
+		}
+		for i := range a.Actions {
+			if !equalNode(&a.Actions[i], &b.Actions[i]) {
+				return false
+			}
+		}
+		return true
+	case *AssingmentNode:
+		b, ok := b.(*AssingmentNode)
+		return ok && operator(a.Operator) == operator(b.Operator) &&
+			equalNode(a.Variable, b.Variable) && equalNode(a.RightExpression, b.RightExpression)
+	case *FunctionNode:
+		b, ok := b.(*FunctionNode)
+		if !ok || a.Function != b.Function || len(a.Args) != len(b.Args) {
+			return false
+		}
+		for i := range a.Args {
+			if !equalNode(&a.Args[i], &b.Args[i]) {
+				return false
+			}
+		}
+		return true
+	case *NumberNode:
+		b, ok := b.(*NumberNode)
+		if !ok {
+			return false
+		}
+		x, y := *a, *b
+		x.Position, y.Position = Position{}, Position{}
+		return x == y
+	case *StringNode:
+		b, ok := b.(*StringNode)
+		return ok && a.Text == b.Text
+	case *BoolNode:
+		b, ok := b.(*BoolNode)
+		return ok && a.IsTrue == b.IsTrue
+	case *DurationNode:
+		b, ok := b.(*DurationNode)
+		return ok && a.Duration == b.Duration && a.Text == b.Text
+	case *DateNode:
+		b, ok := b.(*DateNode)
+		return ok && a.Time.Equal(b.Time) && a.Text == b.Text
+	case *NullNode:
+		_, ok := b.(*NullNode)
+		return ok
+	case *VariableNode:
+		b, ok := b.(*VariableNode)
+		return ok && a.Identifier == b.Identifier
+	case *IdentifierNode:
+		b, ok := b.(*IdentifierNode)
+		if !ok || a.Identifier != b.Identifier || a.IsInput != b.IsInput || len(a.Path) != len(b.Path) {
+			return false
+		}
+		for i := range a.Path {
+			if a.Path[i] != b.Path[i] {
+				return false
+			}
+		}
+		return true
+	case *ExistsNode:
+		b, ok := b.(*ExistsNode)
+		return ok && equalNode(a.Identifier, b.Identifier)
+	case *NotNode:
+		b, ok := b.(*NotNode)
+		return ok && equalNode(a.Expression, b.Expression)
+	case *MathExpressionNode:
+		b, ok := b.(*MathExpressionNode)
+		return ok && a.Identifier == b.Identifier &&
+			equalNode(a.LeftExpression, b.LeftExpression) && equalNode(a.RightExpression, b.RightExpression)
+	case *ConditionalExpressionNode:
+		b, ok := b.(*ConditionalExpressionNode)
+		return ok && a.Identifier == b.Identifier &&
+			equalNode(a.LeftExpression, b.LeftExpression) && equalNode(a.RightExpression, b.RightExpression)
+	}
+	return false
+}
+
+func operator(op string) string {
+	if op == "" {
+		return "="
+	}
+	return op
+}
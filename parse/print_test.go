@@ -0,0 +1,114 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/sazito/mosalat/internal/rulegen"
+)
+
+var printFuncMap = map[string]interface{}{
+	"half": func(n float64) float64 { return n / 2 },
+	"max":  func(n ...float64) float64 { return 0 },
+}
+
+var printInputMap = map[string]interface{}{
+	"a":    float64(0),
+	"b":    float64(0),
+	"c":    float64(0),
+	"d":    float64(0),
+	"s":    "",
+	"flag": false,
+	"user": map[string]interface{}{},
+	"due":  nil,
+}
+
+func printOutputMap() map[string]interface{} {
+	return map[string]interface{}{"x": float64(0), "y": false, "z": "", "tags": []interface{}{}}
+}
+
+func TestPrint(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+	}{
+		{`a>1 | x=2`, `a > 1 | x = 2`},
+		{`x = 2`, `x = 2`},
+		{`a  >   1 | x  =  2,y = true`, `a > 1 | x = 2, y = true`},
+		{`((a + b)) > c | x = 1`, `a + b > c | x = 1`},
+		{`a + (b * c) > 1 | x = 1`, `a + b * c > 1 | x = 1`},
+		{`(a + b) * c > 1 | x = 1`, `(a + b) * c > 1 | x = 1`},
+		{`a - (b - c) > 1 | x = 1`, `a - (b - c) > 1 | x = 1`},
+		{`(a - b) - c > 1 | x = 1`, `a - b - c > 1 | x = 1`},
+		{`a % b + c * d > 1 | x = 1`, `a % b + c * d > 1 | x = 1`},
+		{`(a > 1 && b > 1) || flag | x = 1`, `a > 1 && b > 1 || flag | x = 1`},
+		{`a > 1 && (b > 1 || flag) | x = 1`, `a > 1 && (b > 1 || flag) | x = 1`},
+		{`!(flag) && !(a > 1) | x = 1`, `!flag && !(a > 1) | x = 1`},
+		{`s == "a \"q\" é\t" | x = 1`, `s == "a \"q\" é\t" | x = 1`},
+		{`half( a )>max(1,b,-2.5) | x += 1, tags append "t"`, `half(a) > max(1, b, -2.5) | x += 1, tags append "t"`},
+		{`exists(user) && user?.city == null | x = (x ?? 0) + 1`, `exists(user) && user?.city == null | x = (x ?? 0) + 1`},
+		{`x = x ?? (0 + 1)`, `x = x ?? 0 + 1`},
+		{`(a ?? 0) > 1 | y = a ?? 0 > 1`, `(a ?? 0) > 1 | y = a ?? 0 > 1`},
+		{`y = (a > 1) ?? flag`, `y = a > 1 ?? flag`},
+		{`y = a ?? (b ?? c)`, `y = a ?? (b ?? c)`},
+		{`@2024-03-20 + 1h30m < @j1403-01-01 | x -= ۱۲`, `@2024-03-20 + 1h30m < @j1403-01-01 | x -= 12`},
+	} {
+		ast, err := Parse([]string{c.in}, printFuncMap, printInputMap, printOutputMap())
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.in, err)
+		}
+		got := Print(ast)
+		if len(got) != 1 || got[0] != c.out {
+			t.Errorf("Print(%q) = %q, want %q", c.in, got, c.out)
+			continue
+		}
+		again, err := Parse(got, printFuncMap, printInputMap, printOutputMap())
+		if err != nil {
+			t.Fatalf("parse printed %q: %v", got[0], err)
+		}
+		if !Equal(again, ast) {
+			t.Errorf("%q prints as %q which parses to a different tree", c.in, got[0])
+		}
+	}
+}
+
+func TestPrintRoundTrip(t *testing.T) {
+	g := rulegen.New(1)
+	for i := 0; i < 2000; i++ {
+		rule := g.Rule()
+		ast, err := Parse([]string{rule}, printFuncMap, printInputMap, printOutputMap())
+		if err != nil {
+			t.Fatalf("parse %q: %v", rule, err)
+		}
+		printed := Print(ast)
+		again, err := Parse(printed, printFuncMap, printInputMap, printOutputMap())
+		if err != nil {
+			t.Fatalf("%q prints as %q which does not parse: %v", rule, printed, err)
+		}
+		if !Equal(again, ast) {
+			t.Fatalf("%q prints as %q which parses to a different tree\nwant %s\ngot  %s", rule, printed, ast, again)
+		}
+		if p := Print(again); p[0] != printed[0] {
+			t.Fatalf("printing is not stable: %q, then %q", printed[0], p[0])
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	parse := func(s string) AST {
+		ast, err := Parse([]string{s}, printFuncMap, printInputMap, printOutputMap())
+		if err != nil {
+			t.Fatalf("parse %q: %v", s, err)
+		}
+		return ast
+	}
+	if !Equal(parse(`a > 1 | x = 2`), parse(`(a)  >  (1) | x = (2)`)) {
+		t.Error("parentheses and spacing must not matter")
+	}
+	if !Equal(parse(`a > 1 | x = 2`), AST{Node: *parse(`a > 1 | x = 2`).Node.(*EngineNode)}) {
+		t.Error("value and pointer nodes must be equal")
+	}
+	for _, s := range []string{`a > 2 | x = 2`, `a >= 1 | x = 2`, `b > 1 | x = 2`, `a > 1 | x += 2`, `a > 1 | x = 2, y = true`, `x = 2`} {
+		if Equal(parse(`a > 1 | x = 2`), parse(s)) {
+			t.Errorf("%q must differ", s)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Package persian normalizes the Persian and Arabic forms of digits and
+// letters that look the same but have different code points.
+package persian
+
+import "strings"
+
+// IsDigit reports whether r is a Persian (U+06F0 to U+06F9) or an
+// Arabic-Indic (U+0660 to U+0669) digit.
+func IsDigit(r rune) bool {
+	return ('۰' <= r && r <= '۹') || ('٠' <= r && r <= '٩')
+}
+
+func digit(r rune) rune {
+	switch {
+	case '۰' <= r && r <= '۹':
+		return '0' + r - '۰'
+	case '٠' <= r && r <= '٩':
+		return '0' + r - '٠'
+	}
+	return r
+}
+
+// Digits replaces the Persian and Arabic-Indic digits of s with ASCII
+// digits.
+func Digits(s string) string {
+	if strings.IndexFunc(s, IsDigit) < 0 {
+		return s
+	}
+	return strings.Map(digit, s)
+}
+
+// Normalize replaces the Arabic yeh, alef maksura and kaf of s with the
+// Persian yeh and kaf, and the Persian and Arabic-Indic digits with ASCII
+// digits.
+func Normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case 'ي', 'ى': // arabic yeh, alef maksura
+			return 'ی'
+		case 'ك': // arabic kaf
+			return 'ک'
+		}
+		return digit(r)
+	}, s)
+}
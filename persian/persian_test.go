@@ -0,0 +1,46 @@
+package persian
+
+import "testing"
+
+func TestIsDigit(t *testing.T) {
+	for _, r := range "۰۵۹٠٥٩" {
+		if !IsDigit(r) {
+			t.Errorf("IsDigit(%q) = false", r)
+		}
+	}
+	for _, r := range "09aی" {
+		if IsDigit(r) {
+			t.Errorf("IsDigit(%q) = true", r)
+		}
+	}
+}
+
+func TestDigits(t *testing.T) {
+	for in, want := range map[string]string{
+		"۱۰۰۰":       "1000",
+		"١٢٣":        "123",
+		"۱.۵":        "1.5",
+		"1403/۰۱/٠١": "1403/01/01",
+		"abc":        "abc",
+		"كيك ۲":      "كيك 2",
+	} {
+		if got := Digits(in); got != want {
+			t.Errorf("Digits(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"كيك":     "کیک",
+		"علي":     "علی",
+		"مصطفى":   "مصطفی",
+		"کیک":     "کیک",
+		"پلاك ۱۲": "پلاک 12",
+		"abc":     "abc",
+	} {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
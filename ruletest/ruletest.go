@@ -0,0 +1,212 @@
+// Package ruletest runs declarative test cases against rule sets, so rule
+// authors can test rules without writing Go.
+//
+// A suite is a JSON file:
+//
+//	{
+//	  "rules_file": "discount.rules",
+//	  "inputs": {"country": "IR"},
+//	  "cases": [
+//	    {
+//	      "name": "big orders get a discount",
+//	      "inputs": {"total": 120},
+//	      "outputs": {"discount": 0},
+//	      "expect": {"discount": 10}
+//	    },
+//	    {
+//	      "name": "total must be a number",
+//	      "inputs": {"total": "a lot"},
+//	      "error": "not defined on string"
+//	    }
+//	  ]
+//	}
+//
+// The rules are either listed in "rules" or read from "rules_file", a path
+// relative to the suite with one rule per line where blank lines and lines
+// starting with # are skipped. Suite inputs and outputs are shared by every
+// case and a case overrides them by name. Only the outputs listed in
+// "expect" are compared, after converting them to JSON; a case with "error"
+// passes when running the rules fails with an error containing it.
+package ruletest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sazito/mosalat"
+	"github.com/sazito/mosalat/eval"
+)
+
+// Suite is a set of test cases run against the same rules.
+type Suite struct {
+	Rules     []string               `json:"rules,omitempty"`
+	RulesFile string                 `json:"rules_file,omitempty"`
+	Inputs    map[string]interface{} `json:"inputs,omitempty"`
+	Outputs   map[string]interface{} `json:"outputs,omitempty"`
+	Cases     []Case                 `json:"cases"`
+}
+
+// Case is a named run of the rules with its inputs, initial outputs and the
+// outputs or error expected.
+type Case struct {
+	Name    string                 `json:"name"`
+	Inputs  map[string]interface{} `json:"inputs,omitempty"`
+	Outputs map[string]interface{} `json:"outputs,omitempty"`
+	Expect  map[string]interface{} `json:"expect,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// Result is the outcome of a case, Err is nil when the case passed.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Load reads a suite and the rules file it names.
+func Load(path string) (*Suite, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Suite{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if s.RulesFile != "" {
+		if len(s.Rules) > 0 {
+			return nil, fmt.Errorf("%s: both rules and rules_file are set", path)
+		}
+		rules, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), s.RulesFile))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		s.Rules = SplitRules(string(rules))
+	}
+	if len(s.Cases) == 0 {
+		return nil, fmt.Errorf("%s: no cases", path)
+	}
+	return s, nil
+}
+
+// SplitRules splits the source of a rules file into its rules, one per
+// line, skipping blank lines and lines starting with #.
+func SplitRules(src string) []string {
+	var rules []string
+	for _, l := range strings.Split(src, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		rules = append(rules, l)
+	}
+	return rules
+}
+
+// Run runs every case of the suite with the functions of funcMap.
+func (s *Suite) Run(funcMap map[string]interface{}, opts ...eval.Option) []Result {
+	res := make([]Result, len(s.Cases))
+	for i := range s.Cases {
+		res[i] = Result{
+			Name: s.Cases[i].Name,
+			Err:  s.RunCase(&s.Cases[i], funcMap, opts...),
+		}
+	}
+	return res
+}
+
+// RunCase runs a case and returns a description of every difference with
+// what it expects, nil when it passes.
+func (s *Suite) RunCase(c *Case, funcMap map[string]interface{}, opts ...eval.Option) error {
+	outputs, err := mosalat.Run(s.Rules, funcMap, merge(s.Inputs, c.Inputs), merge(s.Outputs, c.Outputs), opts...)
+	switch {
+	case err != nil && c.Error == "":
+		return fmt.Errorf("unexpected error: %v", err)
+	case err != nil && !strings.Contains(err.Error(), c.Error):
+		return fmt.Errorf("error %q does not contain %q", err, c.Error)
+	case err != nil:
+		return nil
+	case c.Error != "":
+		return fmt.Errorf("expected an error containing %q, got outputs %s", c.Error, marshal(outputs))
+	}
+	got, err := normalize(outputs)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(c.Expect))
+	for k := range c.Expect {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var diffs []string
+	for _, k := range names {
+		v, ok := got[k]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("output %q: missing, want %s", k, marshal(c.Expect[k])))
+		case !reflect.DeepEqual(v, c.Expect[k]):
+			diffs = append(diffs, fmt.Sprintf("output %q: got %s, want %s", k, marshal(v), marshal(c.Expect[k])))
+		}
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, "\n"))
+	}
+	return nil
+}
+
+// Test loads the suite at path and runs every case as a subtest of t.
+func Test(t *testing.T, path string, funcMap map[string]interface{}, opts ...eval.Option) {
+	t.Helper()
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		t.Run(c.Name, func(t *testing.T) {
+			if err := s.RunCase(c, funcMap, opts...); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// merge returns the values of base overridden by those of m.
+func merge(base, m map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(base)+len(m))
+	for k, v := range base {
+		res[k] = v
+	}
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+// normalize converts outputs to the values JSON decodes them to, so they
+// compare with the expected values of a suite.
+func normalize(outputs map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(outputs)
+	if err != nil {
+		return nil, fmt.Errorf("outputs are not JSON: %v", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func marshal(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,31 @@
+package ruletest
+
+import (
+	"testing"
+
+	"github.com/sazito/mosalat/eval"
+	"github.com/sazito/mosalat/stdlib"
+)
+
+func TestSuite(t *testing.T) {
+	Test(t, "testdata/discount.json", stdlib.Funcs(), eval.WithTypeCheck())
+}
+
+func TestFailures(t *testing.T) {
+	s, err := Load("testdata/failing.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`output "discount": got 10, want 5`,
+		`output "tag": missing, want "big"`,
+		`expected an error containing "boom", got outputs {"discount":10}`,
+		`error "type error at rule 0 char 7: operator > not defined on string and number" does not contain "boom"`,
+	}
+	res := s.Run(stdlib.Funcs(), eval.WithTypeCheck())
+	for i, r := range res {
+		if r.Err == nil || r.Err.Error() != want[i] {
+			t.Errorf("case %q: got %v, want %s", r.Name, r.Err, want[i])
+		}
+	}
+}
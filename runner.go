@@ -5,9 +5,11 @@ import (
 	"github.com/sazito/mosalat/parse"
 )
 
-func Run(input []string, funcMap, inputMap, outputMap map[string]interface{}) (map[string]interface{}, error) {
+// Run parses the rules and evaluates them once. The rules are type-checked
+// first only with eval.WithTypeCheck.
+func Run(input []string, funcMap, inputMap, outputMap map[string]interface{}, opts ...eval.Option) (map[string]interface{}, error) {
 	e, err := eval.New(
-		funcMap, inputMap, outputMap,
+		funcMap, inputMap, outputMap, opts...,
 	)
 	if err != nil {
 		return nil, err
@@ -18,3 +20,30 @@ func Run(input []string, funcMap, inputMap, outputMap map[string]interface{}) (m
 	}
 	return e.Eval(ast)
 }
+
+// RunAll is like Run but keeps evaluating after a failing rule, the result
+// holds the outputs of the other rules and the error of every failed rule.
+func RunAll(input []string, funcMap, inputMap, outputMap map[string]interface{}, opts ...eval.Option) (*eval.Result, error) {
+	e, err := eval.New(
+		funcMap, inputMap, outputMap, opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	ast, err := parse.Parse(input, funcMap, inputMap, outputMap)
+	if err != nil {
+		return nil, err
+	}
+	return e.EvalAll(ast)
+}
+
+// NewSession parses the rules over the facts declared in schema and returns
+// a session whose working memory starts with factMap. Facts can be declared
+// without a value and inserted later.
+func NewSession(input []string, funcMap, schema, factMap, outputMap map[string]interface{}, opts ...eval.Option) (*eval.Session, error) {
+	ast, err := parse.Parse(input, funcMap, schema, outputMap)
+	if err != nil {
+		return nil, err
+	}
+	return eval.NewSession(ast, funcMap, schema, factMap, outputMap, opts...)
+}
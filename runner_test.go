@@ -1,5 +1,13 @@
 package mosalat
 
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sazito/mosalat/eval"
+)
+
 // func now() int64 { return time.Now().Unix() }
 // func days(count float64) float64 {
 // 	return count * 24 * 60 * 60
@@ -59,3 +67,113 @@ package mosalat
 // 	}
 // 	fmt.Println(sum / count)
 // }
+
+var errBoom = errors.New("boom")
+
+func TestRunFunctionError(t *testing.T) {
+	funcMap := map[string]interface{}{
+		"fail": func(n float64) (float64, error) {
+			if n > 1 {
+				return 0, errBoom
+			}
+			return n, nil
+		},
+	}
+	_, err := Run([]string{
+		"x = fail(1)",
+		"total > 1 | x = fail(total)",
+	}, funcMap, map[string]interface{}{"total": 2.0}, map[string]interface{}{"x": 0.0})
+	var re *eval.RuleError
+	if !errors.As(err, &re) {
+		t.Fatalf("error %v is not a *eval.RuleError", err)
+	}
+	if re.Rule != 1 || re.Position.Index != 1 {
+		t.Errorf("error in rule %d at %+v, want rule 1", re.Rule, re.Position)
+	}
+	if !errors.Is(err, errBoom) {
+		t.Errorf("error %v does not wrap the error of the function", err)
+	}
+	if want := "rule 1: function fail: boom at line 1 char 20"; err.Error() != want {
+		t.Errorf("error %q, want %q", err, want)
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	funcMap := map[string]interface{}{
+		"fail": func(n float64) (float64, error) {
+			return 0, errBoom
+		},
+	}
+	inputMap := map[string]interface{}{"total": 2.0}
+	outputMap := map[string]interface{}{"x": 0.0, "y": 0.0}
+	res, err := RunAll([]string{
+		"x = 1",
+		"total > 1 | y = 1, x = fail(total)",
+		"y = fail(1)",
+		"total > 1 | y = total",
+	}, funcMap, inputMap, outputMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Outputs["x"] != 1.0 || res.Outputs["y"] != 2.0 {
+		t.Errorf("outputs = %v, want x = 1 and y = 2", res.Outputs)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Rule != 1 || res.Errors[1].Rule != 2 {
+		t.Fatalf("errors = %v, want rules 1 and 2", res.Errors)
+	}
+	for _, re := range res.Errors {
+		if !errors.Is(re, errBoom) {
+			t.Errorf("error %v does not wrap the error of the function", re)
+		}
+	}
+
+	// Type errors stop RunAll before any rule runs when it type-checks.
+	if _, err := RunAll([]string{`x = "a" * 2`}, funcMap, inputMap, outputMap, eval.WithTypeCheck()); err == nil {
+		t.Error("type error: no error")
+	}
+}
+
+// Rules are only type-checked on request, so a rule set whose ill-typed
+// rules never fire still evaluates.
+func TestRunTypeCheck(t *testing.T) {
+	rules := []string{`total > 100 | x = "a"`, "x = total"}
+	inputMap := map[string]interface{}{"total": 2.0}
+	outputs, err := Run(rules, nil, inputMap, map[string]interface{}{"x": 0.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs["x"] != 2.0 {
+		t.Errorf("x = %v, want 2", outputs["x"])
+	}
+	_, err = Run(rules, nil, inputMap, map[string]interface{}{"x": 0.0}, eval.WithTypeCheck())
+	if want := `type error at rule 0 char 15: cannot assign string to "x" of type number`; err == nil || err.Error() != want {
+		t.Errorf("error %v, want %q", err, want)
+	}
+}
+
+// The output type options of the evaluator also apply to the type checker.
+func TestRunOutputTypes(t *testing.T) {
+	outputs, err := Run([]string{`true | x = "a"`}, nil, nil, map[string]interface{}{"x": 1},
+		eval.WithTypeCheck(), eval.WithTypeChanges())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs["x"] != "a" {
+		t.Errorf("x = %#v, want \"a\"", outputs["x"])
+	}
+
+	outputs, err = Run([]string{"n = 3", "n += 1"}, nil, nil, nil,
+		eval.WithTypeCheck(), eval.WithOutputType("n", reflect.TypeOf(int(0))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs["n"] != 4 {
+		t.Errorf("n = %#v, want int 4", outputs["n"])
+	}
+
+	_, err = Run([]string{`n = "a"`}, nil, nil, map[string]interface{}{"n": "b"},
+		eval.WithTypeCheck(), eval.WithOutputType("n", reflect.TypeOf(int(0))))
+	if want := `type error at rule 0 char 1: cannot assign string to "n" of type number`; err == nil || err.Error() != want {
+		t.Errorf("error %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,605 @@
+package serialize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+// BinaryVersion is the version of the binary encoding written by
+// SerializeASTBinary.
+const BinaryVersion = 1
+
+// binaryMagic starts every binary encoded AST.
+var binaryMagic = []byte("MSLB")
+
+// The binary encoding is the magic, the version, a table of every string in
+// the AST and the nodes. A node is its tag, its position and its fields;
+// integers are varints and strings are indexes into the table.
+const (
+	tagNil byte = iota
+	tagEngine
+	tagRule
+	tagExpression
+	tagFunction
+	tagNumber
+	tagString
+	tagBool
+	tagDuration
+	tagDate
+	tagNull
+	tagExists
+	tagNot
+	tagAssignment
+	tagVariable
+	tagIdentifier
+	tagMath
+	tagConditional
+)
+
+// Flags of a number node, only the values whose flag is set are written.
+const (
+	numberInt byte = 1 << iota
+	numberUint
+	numberFloat
+)
+
+// SerializeASTBinary encodes the AST in a compact binary form, much smaller
+// than the gob encoding of SerializeAST.
+func SerializeASTBinary(m parse.AST) ([]byte, error) {
+	e := &binaryEncoder{index: make(map[string]uint64)}
+	if err := e.node(m.Node); err != nil {
+		return nil, err
+	}
+	out := bytes.Buffer{}
+	out.Write(binaryMagic)
+	out.Write(appendUvarint(nil, BinaryVersion))
+	out.Write(appendUvarint(nil, uint64(len(e.strings))))
+	for _, s := range e.strings {
+		out.Write(appendUvarint(nil, uint64(len(s))))
+		out.WriteString(s)
+	}
+	out.Write(e.buf)
+	return out.Bytes(), nil
+}
+
+// DeSerializeBinaryToAST decodes an AST encoded by SerializeASTBinary.
+func DeSerializeBinaryToAST(b []byte) (ast parse.AST, err error) {
+	if !bytes.HasPrefix(b, binaryMagic) {
+		return parse.AST{}, errors.New("not a binary encoded AST")
+	}
+	d := &binaryDecoder{buf: b[len(binaryMagic):]}
+	defer d.recover(&err)
+	if v := d.uvarint(); v != BinaryVersion {
+		return parse.AST{}, fmt.Errorf("unsupported binary version %d", v)
+	}
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.errorf("string table of %d strings is longer than the input", n)
+	}
+	d.strings = make([]string, n)
+	for i := range d.strings {
+		l := d.uvarint()
+		d.strings[i] = string(d.bytes(l))
+	}
+	if d.tag() != tagEngine {
+		d.errorf("AST must start with an engine node")
+	}
+	ast.Node = d.engine()
+	if len(d.buf) > 0 {
+		d.errorf("%d bytes after the AST", len(d.buf))
+	}
+	return ast, nil
+}
+
+type binaryEncoder struct {
+	buf     []byte
+	strings []string
+	index   map[string]uint64
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+func (e *binaryEncoder) uvarint(v uint64) {
+	e.buf = appendUvarint(e.buf, v)
+}
+
+func (e *binaryEncoder) varint(v int64) {
+	e.buf = appendVarint(e.buf, v)
+}
+
+func (e *binaryEncoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *binaryEncoder) string(s string) {
+	i, ok := e.index[s]
+	if !ok {
+		i = uint64(len(e.strings))
+		e.index[s] = i
+		e.strings = append(e.strings, s)
+	}
+	e.uvarint(i)
+}
+
+func (e *binaryEncoder) header(tag byte, pos parse.Position) {
+	e.buf = append(e.buf, tag)
+	e.uvarint(uint64(pos.Index))
+	e.uvarint(uint64(pos.Char))
+}
+
+func (e *binaryEncoder) node(node parse.Node) error {
+	switch n := node.(type) {
+	case nil:
+		e.buf = append(e.buf, tagNil)
+	case *parse.EngineNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.EngineNode:
+		e.header(tagEngine, n.Position)
+		e.uvarint(uint64(len(n.Rules)))
+		for _, r := range n.Rules {
+			if err := e.node(r); err != nil {
+				return err
+			}
+		}
+	case *parse.RuleNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.RuleNode:
+		e.header(tagRule, n.Position)
+		if err := e.expression(n.Condition); err != nil {
+			return err
+		}
+		e.uvarint(uint64(len(n.Actions)))
+		for _, a := range n.Actions {
+			if err := e.node(a); err != nil {
+				return err
+			}
+		}
+	case *parse.AssingmentNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.AssingmentNode:
+		e.header(tagAssignment, n.Position)
+		if n.Variable == nil {
+			return fmt.Errorf("assignment at line %d char %d has no variable", n.Index, n.Char)
+		}
+		e.string(n.Operator)
+		if err := e.node(*n.Variable); err != nil {
+			return err
+		}
+		return e.expression(n.RightExpression)
+	case *parse.ExpressionNode:
+		return e.expression(n)
+	case parse.ExpressionNode:
+		return e.expression(&n)
+	case *parse.FunctionNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.FunctionNode:
+		e.header(tagFunction, n.Position)
+		e.string(n.Function)
+		e.uvarint(uint64(len(n.Args)))
+		for i := range n.Args {
+			if err := e.expression(&n.Args[i]); err != nil {
+				return err
+			}
+		}
+	case *parse.NumberNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.NumberNode:
+		e.header(tagNumber, n.Position)
+		var flags byte
+		if n.IsInt {
+			flags |= numberInt
+		}
+		if n.IsUint {
+			flags |= numberUint
+		}
+		if n.IsFloat {
+			flags |= numberFloat
+		}
+		e.buf = append(e.buf, flags)
+		if n.IsInt {
+			e.varint(n.Int64)
+		}
+		if n.IsUint {
+			e.uvarint(n.Uint64)
+		}
+		if n.IsFloat {
+			var tmp [8]byte
+			binary.LittleEndian.PutUint64(tmp[:], math.Float64bits(n.Float64))
+			e.buf = append(e.buf, tmp[:]...)
+		}
+		e.string(n.Text)
+	case *parse.StringNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.StringNode:
+		e.header(tagString, n.Position)
+		e.string(n.Text)
+		e.string(n.RawText)
+	case *parse.BoolNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.BoolNode:
+		e.header(tagBool, n.Position)
+		e.bool(n.IsTrue)
+	case *parse.DurationNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.DurationNode:
+		e.header(tagDuration, n.Position)
+		e.varint(int64(n.Duration))
+		e.string(n.Text)
+	case *parse.DateNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.DateNode:
+		e.header(tagDate, n.Position)
+		_, offset := n.Time.Zone()
+		e.varint(n.Time.Unix())
+		e.uvarint(uint64(n.Time.Nanosecond()))
+		e.varint(int64(offset))
+		e.string(n.Text)
+	case *parse.NullNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.NullNode:
+		e.header(tagNull, n.Position)
+	case *parse.ExistsNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.ExistsNode:
+		e.header(tagExists, n.Position)
+		if n.Identifier == nil {
+			e.buf = append(e.buf, tagNil)
+			return nil
+		}
+		return e.node(*n.Identifier)
+	case *parse.NotNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.NotNode:
+		e.header(tagNot, n.Position)
+		return e.node(n.Expression)
+	case *parse.VariableNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.VariableNode:
+		e.header(tagVariable, n.Position)
+		e.string(n.Identifier)
+	case *parse.IdentifierNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.IdentifierNode:
+		e.header(tagIdentifier, n.Position)
+		e.string(n.Identifier)
+		e.bool(n.IsInput)
+		e.uvarint(uint64(len(n.Path)))
+		for _, s := range n.Path {
+			e.string(s.Name)
+			e.bool(s.Optional)
+		}
+	case *parse.MathExpressionNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.MathExpressionNode:
+		return e.binary(tagMath, n.Position, n.Identifier, n.LeftExpression, n.RightExpression)
+	case *parse.ConditionalExpressionNode:
+		if n == nil {
+			return e.node(nil)
+		}
+		return e.node(*n)
+	case parse.ConditionalExpressionNode:
+		return e.binary(tagConditional, n.Position, n.Identifier, n.LeftExpression, n.RightExpression)
+	default:
+		return fmt.Errorf("cannot encode node %T", node)
+	}
+	return nil
+}
+
+func (e *binaryEncoder) expression(n *parse.ExpressionNode) error {
+	if n == nil {
+		e.buf = append(e.buf, tagNil)
+		return nil
+	}
+	e.header(tagExpression, n.Position)
+	return e.node(n.Expression)
+}
+
+func (e *binaryEncoder) binary(tag byte, pos parse.Position, op string, left, right parse.Node) error {
+	e.header(tag, pos)
+	e.string(op)
+	if err := e.node(left); err != nil {
+		return err
+	}
+	return e.node(right)
+}
+
+// maxBinaryDepth bounds the nesting of decoded nodes, so that a crafted
+// input cannot exhaust the stack.
+const maxBinaryDepth = 10000
+
+type binaryDecoder struct {
+	buf     []byte
+	strings []string
+	depth   int
+}
+
+type binaryError struct {
+	err error
+}
+
+func (d *binaryDecoder) errorf(format string, args ...interface{}) {
+	panic(binaryError{fmt.Errorf(format, args...)})
+}
+
+func (d *binaryDecoder) recover(errp *error) {
+	if e := recover(); e != nil {
+		be, ok := e.(binaryError)
+		if !ok {
+			panic(e)
+		}
+		*errp = be.err
+	}
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.errorf("malformed varint")
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.errorf("malformed varint")
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) int() int {
+	v := d.uvarint()
+	if v > math.MaxInt32 {
+		d.errorf("integer %d out of range", v)
+	}
+	return int(v)
+}
+
+func (d *binaryDecoder) bytes(n uint64) []byte {
+	if n > uint64(len(d.buf)) {
+		d.errorf("unexpected end of input")
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *binaryDecoder) byte() byte {
+	return d.bytes(1)[0]
+}
+
+func (d *binaryDecoder) bool() bool {
+	return d.byte() != 0
+}
+
+func (d *binaryDecoder) string() string {
+	i := d.uvarint()
+	if i >= uint64(len(d.strings)) {
+		d.errorf("string %d is not in the table", i)
+	}
+	return d.strings[i]
+}
+
+func (d *binaryDecoder) tag() byte {
+	return d.byte()
+}
+
+func (d *binaryDecoder) pos() parse.Position {
+	return parse.Position{Index: d.int(), Char: d.int()}
+}
+
+// count reads the length of a list, every element takes at least a byte.
+func (d *binaryDecoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.errorf("list of %d elements is longer than the input", n)
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder) expect(tag byte) {
+	if t := d.tag(); t != tag {
+		d.errorf("unexpected node tag %d, want %d", t, tag)
+	}
+}
+
+func (d *binaryDecoder) engine() *parse.EngineNode {
+	n := &parse.EngineNode{Position: d.pos()}
+	for i := d.count(); i > 0; i-- {
+		d.expect(tagRule)
+		n.Rules = append(n.Rules, d.rule())
+	}
+	return n
+}
+
+func (d *binaryDecoder) rule() parse.RuleNode {
+	n := parse.RuleNode{Position: d.pos()}
+	n.Condition = d.expression()
+	for i := d.count(); i > 0; i-- {
+		d.expect(tagAssignment)
+		a := parse.AssingmentNode{Position: d.pos(), Operator: d.string()}
+		if d.tag() != tagVariable {
+			d.errorf("assignment must have a variable")
+		}
+		a.Variable = &parse.VariableNode{Position: d.pos(), Identifier: d.string()}
+		a.RightExpression = d.expression()
+		n.Actions = append(n.Actions, a)
+	}
+	return n
+}
+
+// expression reads an optional expression node.
+func (d *binaryDecoder) expression() *parse.ExpressionNode {
+	switch d.tag() {
+	case tagNil:
+		return nil
+	case tagExpression:
+		return &parse.ExpressionNode{Position: d.pos(), Expression: d.node()}
+	}
+	d.errorf("expected an expression node")
+	return nil
+}
+
+func (d *binaryDecoder) node() parse.Node {
+	d.depth++
+	if d.depth > maxBinaryDepth {
+		d.errorf("AST is nested deeper than %d nodes", maxBinaryDepth)
+	}
+	defer func() { d.depth-- }()
+	tag := d.tag()
+	if tag == tagNil {
+		return nil
+	}
+	pos := d.pos()
+	switch tag {
+	case tagExpression:
+		return &parse.ExpressionNode{Position: pos, Expression: d.node()}
+	case tagFunction:
+		n := &parse.FunctionNode{Position: pos, Function: d.string()}
+		for i := d.count(); i > 0; i-- {
+			a := d.expression()
+			if a == nil {
+				d.errorf("function argument must be an expression")
+			}
+			n.Args = append(n.Args, *a)
+		}
+		return n
+	case tagNumber:
+		n := &parse.NumberNode{Position: pos}
+		flags := d.byte()
+		if flags&numberInt != 0 {
+			n.IsInt = true
+			n.Int64 = d.varint()
+		}
+		if flags&numberUint != 0 {
+			n.IsUint = true
+			n.Uint64 = d.uvarint()
+		}
+		if flags&numberFloat != 0 {
+			n.IsFloat = true
+			n.Float64 = math.Float64frombits(binary.LittleEndian.Uint64(d.bytes(8)))
+		}
+		n.Text = d.string()
+		return n
+	case tagString:
+		return &parse.StringNode{Position: pos, Text: d.string(), RawText: d.string()}
+	case tagBool:
+		return &parse.BoolNode{Position: pos, IsTrue: d.bool()}
+	case tagDuration:
+		return &parse.DurationNode{Position: pos, Duration: time.Duration(d.varint()), Text: d.string()}
+	case tagDate:
+		sec, nsec, offset := d.varint(), d.uvarint(), d.varint()
+		if nsec >= uint64(time.Second) {
+			d.errorf("malformed date")
+		}
+		loc := time.UTC
+		if offset != 0 {
+			loc = time.FixedZone("", int(offset))
+		}
+		return &parse.DateNode{Position: pos, Time: time.Unix(sec, int64(nsec)).In(loc), Text: d.string()}
+	case tagNull:
+		return &parse.NullNode{Position: pos}
+	case tagExists:
+		n := &parse.ExistsNode{Position: pos}
+		if id := d.node(); id != nil {
+			i, ok := id.(*parse.IdentifierNode)
+			if !ok {
+				d.errorf("exists must have an identifier")
+			}
+			n.Identifier = i
+		}
+		return n
+	case tagNot:
+		return &parse.NotNode{Position: pos, Expression: d.node()}
+	case tagVariable:
+		return &parse.VariableNode{Position: pos, Identifier: d.string()}
+	case tagIdentifier:
+		n := &parse.IdentifierNode{Position: pos, Identifier: d.string(), IsInput: d.bool()}
+		for i := d.count(); i > 0; i-- {
+			n.Path = append(n.Path, parse.Selector{Name: d.string(), Optional: d.bool()})
+		}
+		return n
+	case tagMath, tagConditional:
+		op := d.string()
+		l := d.node()
+		r := d.node()
+		var n parse.Node
+		var err error
+		if tag == tagMath {
+			n, err = parse.NewMathExpressionNode(pos, op, l, r)
+		} else {
+			n, err = parse.NewConditionalExpressionNode(pos, op, l, r)
+		}
+		if err != nil {
+			d.errorf("%s", err)
+		}
+		return n
+	}
+	d.errorf("unknown node tag %d", tag)
+	return nil
+}
@@ -0,0 +1,214 @@
+package serialize
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sazito/mosalat/internal/rulegen"
+	"github.com/sazito/mosalat/parse"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	g := rulegen.New(2)
+	for i := 0; i < 500; i++ {
+		rules := g.Rules()
+		ast, err := parse.Parse(rules, genFuncMap, genInputMap(), genOutputMap())
+		if err != nil {
+			t.Fatalf("parse %q: %v", rules, err)
+		}
+		b, err := SerializeASTBinary(ast)
+		if err != nil {
+			t.Fatalf("serialize %q: %v", rules, err)
+		}
+		got, err := DeSerializeBinaryToAST(b)
+		if err != nil {
+			t.Fatalf("deserialize %q: %v", rules, err)
+		}
+		if !reflect.DeepEqual(got, ast) {
+			t.Fatalf("round trip of %q changed the AST\nwant %s\ngot  %s", rules, ast, got)
+		}
+	}
+	for _, rules := range jsonRules {
+		ast, err := parse.Parse(rules, jsonFuncMap, jsonInputMap, map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("parse %q: %v", rules, err)
+		}
+		b, err := SerializeASTBinary(ast)
+		if err != nil {
+			t.Fatalf("serialize %q: %v", rules, err)
+		}
+		got, err := DeSerializeBinaryToAST(b)
+		if err != nil {
+			t.Fatalf("deserialize %q: %v", rules, err)
+		}
+		if !reflect.DeepEqual(got, ast) {
+			t.Errorf("round trip of %q changed the AST\nwant %s\ngot  %s", rules, ast, got)
+		}
+	}
+}
+
+func TestBinaryCorrupt(t *testing.T) {
+	ast, err := parse.Parse(jsonRules[1], jsonFuncMap, jsonInputMap, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SerializeASTBinary(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every truncation must fail cleanly, never panic.
+	for i := 0; i < len(b); i++ {
+		if _, err := DeSerializeBinaryToAST(b[:i]); err == nil {
+			t.Errorf("no error decoding %d of %d bytes", i, len(b))
+		}
+	}
+	r := rand.New(rand.NewSource(3))
+	for i := 0; i < 1000; i++ {
+		c := append([]byte(nil), b...)
+		c[len(binaryMagic)+r.Intn(len(c)-len(binaryMagic))] ^= byte(1 + r.Intn(255))
+		DeSerializeBinaryToAST(c)
+	}
+}
+
+// binaryBlob returns an encoding of one rule with the string table and
+// the bytes after the rule position.
+func binaryBlob(table []string, rule ...byte) []byte {
+	b := append([]byte(nil), binaryMagic...)
+	b = append(b, BinaryVersion, byte(len(table)))
+	for _, s := range table {
+		b = append(b, byte(len(s)))
+		b = append(b, s...)
+	}
+	b = append(b, tagEngine, 0, 0, 1, tagRule, 0, 0)
+	return append(b, rule...)
+}
+
+func TestBinaryInvalid(t *testing.T) {
+	deep := []byte{tagExpression, 0, 0}
+	deep = append(deep, bytes.Repeat([]byte{tagNot, 0, 0}, 1<<20)...)
+	deep = append(deep, tagBool, 0, 0, 1, 0)
+	for _, c := range []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"deep", binaryBlob(nil, deep...), "nested deeper than"},
+		{"nil variable", binaryBlob([]string{"="}, tagNil, 1, tagAssignment, 0, 0, 0, tagNil, tagNil), "assignment must have a variable"},
+	} {
+		_, err := DeSerializeBinaryToAST(c.b)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want an error containing %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestBinaryNilNodes(t *testing.T) {
+	for _, n := range []parse.Node{
+		(*parse.FunctionNode)(nil),
+		(*parse.NumberNode)(nil),
+		(*parse.StringNode)(nil),
+		(*parse.BoolNode)(nil),
+		(*parse.DurationNode)(nil),
+		(*parse.DateNode)(nil),
+		(*parse.NullNode)(nil),
+		(*parse.ExistsNode)(nil),
+		(*parse.NotNode)(nil),
+		(*parse.VariableNode)(nil),
+		(*parse.IdentifierNode)(nil),
+		(*parse.MathExpressionNode)(nil),
+		(*parse.ConditionalExpressionNode)(nil),
+	} {
+		e := &binaryEncoder{index: make(map[string]uint64)}
+		if err := e.node(n); err != nil || !bytes.Equal(e.buf, []byte{tagNil}) {
+			t.Errorf("node(%T(nil)) = %v, %v", n, e.buf, err)
+		}
+	}
+	ast := parse.AST{Node: &parse.EngineNode{Rules: []parse.RuleNode{{
+		Actions: []parse.AssingmentNode{{Operator: "="}},
+	}}}}
+	if _, err := SerializeASTBinary(ast); err == nil {
+		t.Error("no error encoding an assignment without a variable")
+	}
+}
+
+func benchmarkAST(b *testing.B) parse.AST {
+	g := rulegen.New(4)
+	var rules []string
+	for len(rules) < 50 {
+		rules = append(rules, g.Rules()...)
+	}
+	ast, err := parse.Parse(rules, genFuncMap, genInputMap(), genOutputMap())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return ast
+}
+
+func BenchmarkEncodeGob(b *testing.B) {
+	ast := benchmarkAST(b)
+	var s string
+	for i := 0; i < b.N; i++ {
+		s, _ = SerializeAST(ast)
+	}
+	b.ReportMetric(float64(len(s)), "bytes/ast")
+}
+
+func BenchmarkDecodeGob(b *testing.B) {
+	s, err := SerializeAST(benchmarkAST(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DeSerializeToAST(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	ast := benchmarkAST(b)
+	var s []byte
+	for i := 0; i < b.N; i++ {
+		s, _ = SerializeASTJSON(ast)
+	}
+	b.ReportMetric(float64(len(s)), "bytes/ast")
+}
+
+func BenchmarkDecodeJSON(b *testing.B) {
+	s, err := SerializeASTJSON(benchmarkAST(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DeSerializeJSONToAST(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeBinary(b *testing.B) {
+	ast := benchmarkAST(b)
+	var s []byte
+	for i := 0; i < b.N; i++ {
+		s, _ = SerializeASTBinary(ast)
+	}
+	b.ReportMetric(float64(len(s)), "bytes/ast")
+}
+
+func BenchmarkDecodeBinary(b *testing.B) {
+	s, err := SerializeASTBinary(benchmarkAST(b))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DeSerializeBinaryToAST(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+package serialize
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+// JSONVersion is the version of the JSON encoding written by SerializeASTJSON.
+const JSONVersion = 1
+
+type jsonAST struct {
+	Version int       `json:"version"`
+	AST     *jsonNode `json:"ast"`
+}
+
+type jsonPosition struct {
+	Line int `json:"line"`
+	Char int `json:"char"`
+}
+
+// jsonNode is the JSON form of every node, Type tells which node it is and
+// which of the other fields are set.
+type jsonNode struct {
+	Type     string       `json:"type"`
+	Position jsonPosition `json:"pos"`
+
+	Rules      []*jsonNode `json:"rules,omitempty"`
+	Condition  *jsonNode   `json:"condition,omitempty"`
+	Actions    []*jsonNode `json:"actions,omitempty"`
+	Operator   string      `json:"operator,omitempty"`
+	Variable   *jsonNode   `json:"variable,omitempty"`
+	Expression *jsonNode   `json:"expression,omitempty"`
+	Left       *jsonNode   `json:"left,omitempty"`
+	Right      *jsonNode   `json:"right,omitempty"`
+
+	Function string      `json:"function,omitempty"`
+	Args     []*jsonNode `json:"args,omitempty"`
+
+	Name  string         `json:"name,omitempty"`
+	Input bool           `json:"input,omitempty"`
+	Path  []jsonSelector `json:"path,omitempty"`
+
+	Text     string    `json:"text,omitempty"`
+	Raw      string    `json:"raw,omitempty"`
+	Bool     bool      `json:"value,omitempty"`
+	IsInt    bool      `json:"is_int,omitempty"`
+	IsUint   bool      `json:"is_uint,omitempty"`
+	IsFloat  bool      `json:"is_float,omitempty"`
+	Int64    int64     `json:"int,omitempty"`
+	Uint64   uint64    `json:"uint,omitempty"`
+	Float64  float64   `json:"float,omitempty"`
+	Duration int64     `json:"duration,omitempty"`
+	Time     *jsonTime `json:"time,omitempty"`
+}
+
+type jsonSelector struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+type jsonTime struct {
+	time.Time
+}
+
+func (t jsonTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Format(time.RFC3339Nano))
+}
+
+func (t *jsonTime) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return err
+	}
+	t.Time = v
+	return nil
+}
+
+// SerializeASTJSON encodes the AST as JSON, every node is an object with a
+// "type" and a "pos", so stored rules can be read without Go.
+func SerializeASTJSON(m parse.AST) ([]byte, error) {
+	n, err := toJSON(m.Node)
+	if err != nil {
+		return nil, err
+	}
+	// Operators such as > and && are kept readable instead of HTML escaped.
+	b := bytes.Buffer{}
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(jsonAST{Version: JSONVersion, AST: n}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// DeSerializeJSONToAST decodes an AST encoded by SerializeASTJSON, the nodes
+// have the same shape as the ones built by parse.Parse.
+func DeSerializeJSONToAST(b []byte) (parse.AST, error) {
+	var j jsonAST
+	if err := json.Unmarshal(b, &j); err != nil {
+		return parse.AST{}, err
+	}
+	if j.Version != JSONVersion {
+		return parse.AST{}, fmt.Errorf("unsupported JSON version %d", j.Version)
+	}
+	if j.AST == nil || j.AST.Type != "engine" {
+		return parse.AST{}, fmt.Errorf("JSON AST must start with an engine node")
+	}
+	n, err := fromJSON(j.AST)
+	if err != nil {
+		return parse.AST{}, err
+	}
+	return parse.AST{Node: n}, nil
+}
+
+func jsonPos(p parse.Position) jsonPosition {
+	return jsonPosition{Line: p.Index, Char: p.Char}
+}
+
+func toJSON(node parse.Node) (*jsonNode, error) {
+	switch n := node.(type) {
+	case nil:
+		return nil, nil
+	case *parse.EngineNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.EngineNode:
+		j := &jsonNode{Type: "engine", Position: jsonPos(n.Position)}
+		for _, r := range n.Rules {
+			rj, err := toJSON(r)
+			if err != nil {
+				return nil, err
+			}
+			j.Rules = append(j.Rules, rj)
+		}
+		return j, nil
+	case *parse.RuleNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.RuleNode:
+		j := &jsonNode{Type: "rule", Position: jsonPos(n.Position)}
+		if n.Condition != nil {
+			c, err := toJSON(*n.Condition)
+			if err != nil {
+				return nil, err
+			}
+			j.Condition = c
+		}
+		for _, a := range n.Actions {
+			aj, err := toJSON(a)
+			if err != nil {
+				return nil, err
+			}
+			j.Actions = append(j.Actions, aj)
+		}
+		return j, nil
+	case *parse.AssingmentNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.AssingmentNode:
+		j := &jsonNode{Type: "assignment", Position: jsonPos(n.Position), Operator: n.Operator}
+		if n.Variable != nil {
+			j.Variable = &jsonNode{Type: "variable", Position: jsonPos(n.Variable.Position), Name: n.Variable.Identifier}
+		}
+		if n.RightExpression != nil {
+			r, err := toJSON(*n.RightExpression)
+			if err != nil {
+				return nil, err
+			}
+			j.Right = r
+		}
+		return j, nil
+	case *parse.ExpressionNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.ExpressionNode:
+		e, err := toJSON(n.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: "expression", Position: jsonPos(n.Position), Expression: e}, nil
+	case *parse.FunctionNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.FunctionNode:
+		j := &jsonNode{Type: "function", Position: jsonPos(n.Position), Function: n.Function}
+		for _, a := range n.Args {
+			aj, err := toJSON(a)
+			if err != nil {
+				return nil, err
+			}
+			j.Args = append(j.Args, aj)
+		}
+		return j, nil
+	case *parse.NumberNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.NumberNode:
+		return &jsonNode{
+			Type:     "number",
+			Position: jsonPos(n.Position),
+			Text:     n.Text,
+			IsInt:    n.IsInt,
+			IsUint:   n.IsUint,
+			IsFloat:  n.IsFloat,
+			Int64:    n.Int64,
+			Uint64:   n.Uint64,
+			Float64:  n.Float64,
+		}, nil
+	case *parse.StringNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.StringNode:
+		return &jsonNode{Type: "string", Position: jsonPos(n.Position), Text: n.Text, Raw: n.RawText}, nil
+	case *parse.BoolNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.BoolNode:
+		return &jsonNode{Type: "bool", Position: jsonPos(n.Position), Bool: n.IsTrue}, nil
+	case *parse.DurationNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.DurationNode:
+		return &jsonNode{Type: "duration", Position: jsonPos(n.Position), Text: n.Text, Duration: int64(n.Duration)}, nil
+	case *parse.DateNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.DateNode:
+		return &jsonNode{Type: "date", Position: jsonPos(n.Position), Text: n.Text, Time: &jsonTime{n.Time}}, nil
+	case *parse.NullNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.NullNode:
+		return &jsonNode{Type: "null", Position: jsonPos(n.Position)}, nil
+	case *parse.ExistsNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.ExistsNode:
+		j := &jsonNode{Type: "exists", Position: jsonPos(n.Position)}
+		if n.Identifier != nil {
+			id, err := toJSON(*n.Identifier)
+			if err != nil {
+				return nil, err
+			}
+			j.Expression = id
+		}
+		return j, nil
+	case *parse.NotNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.NotNode:
+		e, err := toJSON(n.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{Type: "not", Position: jsonPos(n.Position), Expression: e}, nil
+	case *parse.VariableNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.VariableNode:
+		return &jsonNode{Type: "variable", Position: jsonPos(n.Position), Name: n.Identifier}, nil
+	case *parse.IdentifierNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.IdentifierNode:
+		j := &jsonNode{Type: "identifier", Position: jsonPos(n.Position), Name: n.Identifier, Input: n.IsInput}
+		for _, s := range n.Path {
+			j.Path = append(j.Path, jsonSelector{Name: s.Name, Optional: s.Optional})
+		}
+		return j, nil
+	case *parse.MathExpressionNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.MathExpressionNode:
+		return binaryToJSON("math", n.Position, n.Identifier, n.LeftExpression, n.RightExpression)
+	case *parse.ConditionalExpressionNode:
+		if n == nil {
+			return nil, nil
+		}
+		return toJSON(*n)
+	case parse.ConditionalExpressionNode:
+		return binaryToJSON("conditional", n.Position, n.Identifier, n.LeftExpression, n.RightExpression)
+	}
+	return nil, fmt.Errorf("cannot encode node %T to JSON", node)
+}
+
+func binaryToJSON(typ string, pos parse.Position, op string, left, right parse.Node) (*jsonNode, error) {
+	l, err := toJSON(left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toJSON(right)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonNode{Type: typ, Position: jsonPos(pos), Operator: op, Left: l, Right: r}, nil
+}
+
+func (j *jsonNode) pos() parse.Position {
+	return parse.Position{Index: j.Position.Line, Char: j.Position.Char}
+}
+
+// fromJSON decodes a node, nodes are pointers as in the trees of the parser,
+// rules, actions and function arguments are decoded by their parents.
+func fromJSON(j *jsonNode) (parse.Node, error) {
+	if j == nil {
+		return nil, nil
+	}
+	switch j.Type {
+	case "engine":
+		n := &parse.EngineNode{Position: j.pos()}
+		for _, rj := range j.Rules {
+			r, err := ruleFromJSON(rj)
+			if err != nil {
+				return nil, err
+			}
+			n.Rules = append(n.Rules, r)
+		}
+		return n, nil
+	case "expression":
+		return expressionFromJSON(j)
+	case "function":
+		n := &parse.FunctionNode{Position: j.pos(), Function: j.Function}
+		for _, aj := range j.Args {
+			a, err := expressionFromJSON(aj)
+			if err != nil {
+				return nil, err
+			}
+			n.Args = append(n.Args, *a)
+		}
+		return n, nil
+	case "number":
+		return &parse.NumberNode{
+			Position: j.pos(),
+			IsInt:    j.IsInt,
+			IsUint:   j.IsUint,
+			IsFloat:  j.IsFloat,
+			Int64:    j.Int64,
+			Uint64:   j.Uint64,
+			Float64:  j.Float64,
+			Text:     j.Text,
+		}, nil
+	case "string":
+		return &parse.StringNode{Position: j.pos(), Text: j.Text, RawText: j.Raw}, nil
+	case "bool":
+		return &parse.BoolNode{Position: j.pos(), IsTrue: j.Bool}, nil
+	case "duration":
+		return &parse.DurationNode{Position: j.pos(), Text: j.Text, Duration: time.Duration(j.Duration)}, nil
+	case "date":
+		if j.Time == nil {
+			return nil, fmt.Errorf("date node at line %d char %d has no time", j.Position.Line, j.Position.Char)
+		}
+		return &parse.DateNode{Position: j.pos(), Text: j.Text, Time: j.Time.Time}, nil
+	case "null":
+		return &parse.NullNode{Position: j.pos()}, nil
+	case "exists":
+		n := &parse.ExistsNode{Position: j.pos()}
+		if j.Expression != nil {
+			id, err := fromJSON(j.Expression)
+			if err != nil {
+				return nil, err
+			}
+			i, ok := id.(*parse.IdentifierNode)
+			if !ok {
+				return nil, fmt.Errorf("exists at line %d char %d must have an identifier", j.Position.Line, j.Position.Char)
+			}
+			n.Identifier = i
+		}
+		return n, nil
+	case "not":
+		e, err := j.operand(j.Expression, "expression")
+		if err != nil {
+			return nil, err
+		}
+		return &parse.NotNode{Position: j.pos(), Expression: e}, nil
+	case "variable":
+		return &parse.VariableNode{Position: j.pos(), Identifier: j.Name}, nil
+	case "identifier":
+		n := &parse.IdentifierNode{Position: j.pos(), Identifier: j.Name, IsInput: j.Input}
+		for _, s := range j.Path {
+			n.Path = append(n.Path, parse.Selector{Name: s.Name, Optional: s.Optional})
+		}
+		return n, nil
+	case "math", "conditional":
+		l, err := j.operand(j.Left, "left")
+		if err != nil {
+			return nil, err
+		}
+		r, err := j.operand(j.Right, "right")
+		if err != nil {
+			return nil, err
+		}
+		if j.Type == "math" {
+			return parse.NewMathExpressionNode(j.pos(), j.Operator, l, r)
+		}
+		return parse.NewConditionalExpressionNode(j.pos(), j.Operator, l, r)
+	}
+	return nil, fmt.Errorf("unknown node type %q at line %d char %d", j.Type, j.Position.Line, j.Position.Char)
+}
+
+func ruleFromJSON(j *jsonNode) (parse.RuleNode, error) {
+	if j == nil || j.Type != "rule" {
+		return parse.RuleNode{}, fmt.Errorf("engine must contain rule nodes")
+	}
+	n := parse.RuleNode{Position: j.pos()}
+	if j.Condition != nil {
+		c, err := expressionFromJSON(j.Condition)
+		if err != nil {
+			return parse.RuleNode{}, err
+		}
+		n.Condition = c
+	}
+	for _, aj := range j.Actions {
+		if aj == nil || aj.Type != "assignment" {
+			return parse.RuleNode{}, fmt.Errorf("rule at line %d must contain assignment nodes", j.Position.Line)
+		}
+		if aj.Variable == nil || aj.Variable.Name == "" {
+			return parse.RuleNode{}, fmt.Errorf("assignment node at line %d char %d has no variable", aj.Position.Line, aj.Position.Char)
+		}
+		a := parse.AssingmentNode{Position: aj.pos(), Operator: aj.Operator}
+		a.Variable = &parse.VariableNode{Position: aj.Variable.pos(), Identifier: aj.Variable.Name}
+		r, err := expressionFromJSON(aj.Right)
+		if err != nil {
+			return parse.RuleNode{}, err
+		}
+		a.RightExpression = r
+		n.Actions = append(n.Actions, a)
+	}
+	return n, nil
+}
+
+func expressionFromJSON(j *jsonNode) (*parse.ExpressionNode, error) {
+	if j == nil {
+		return nil, fmt.Errorf("expected expression node, got null")
+	}
+	if j.Type != "expression" {
+		return nil, fmt.Errorf("expected expression node at line %d char %d, got %q", j.Position.Line, j.Position.Char, j.Type)
+	}
+	e, err := j.operand(j.Expression, "expression")
+	if err != nil {
+		return nil, err
+	}
+	return &parse.ExpressionNode{Position: j.pos(), Expression: e}, nil
+}
+
+// operand decodes a child node of j that the evaluator needs, a missing or
+// null child is an error.
+func (j *jsonNode) operand(child *jsonNode, field string) (parse.Node, error) {
+	if child == nil {
+		return nil, fmt.Errorf("%s node at line %d char %d has no %s", j.Type, j.Position.Line, j.Position.Char, field)
+	}
+	return fromJSON(child)
+}
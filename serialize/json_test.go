@@ -0,0 +1,162 @@
+package serialize
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+var jsonFuncMap = map[string]interface{}{
+	"days": func(n float64) float64 { return n * 24 },
+	"max":  func(n ...float64) float64 { return 0 },
+}
+
+var jsonInputMap = map[string]interface{}{
+	"amount":   float64(0),
+	"name":     "",
+	"vip":      false,
+	"customer": map[string]interface{}{},
+	"coupon":   "",
+}
+
+var jsonRules = [][]string{
+	{`amount > 10 | discount = 5`},
+	{`amount >= 10 && !vip || name == "ali \"k\"" | discount = amount * 2 + 3 % 2, reason = "a\tb"`},
+	{`(amount - 1) / 2 < days(3) | score += 1, tags append "x"`},
+	{`max(1, amount, -2.5) != 0x1f | total -= 1.5e3`},
+	{`exists(coupon) && customer.address?.city == "Kish" | discount = (discount ?? 0) + 10`},
+	{`@2024-03-20T10:30 < @j1403-01-01 | due = @2024-03-20 + 1h30m`},
+	{`coupon == null | discount *= 2`, `true | discount /= 3`},
+	{`amount <= ۱۲ | flag = true, other = false`},
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, rules := range jsonRules {
+		ast, err := parse.Parse(rules, jsonFuncMap, jsonInputMap, map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("parse %q: %v", rules, err)
+		}
+		b, err := SerializeASTJSON(ast)
+		if err != nil {
+			t.Fatalf("serialize %q: %v", rules, err)
+		}
+		got, err := DeSerializeJSONToAST(b)
+		if err != nil {
+			t.Fatalf("deserialize %q: %v\n%s", rules, err, b)
+		}
+		if !reflect.DeepEqual(got, ast) {
+			t.Errorf("round trip of %q changed the AST\nwant %s\ngot  %s", rules, ast, got)
+		}
+		again, err := SerializeASTJSON(got)
+		if err != nil {
+			t.Fatalf("serialize again %q: %v", rules, err)
+		}
+		if string(again) != string(b) {
+			t.Errorf("encoding of %q is not stable\n%s\n%s", rules, b, again)
+		}
+	}
+}
+
+func TestJSONValueNodes(t *testing.T) {
+	ast, err := parse.Parse(jsonRules[1], jsonFuncMap, jsonInputMap, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SerializeASTJSON(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := parse.AST{Node: *ast.Node.(*parse.EngineNode)}
+	vb, err := SerializeASTJSON(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(vb) != string(b) {
+		t.Errorf("value and pointer nodes encode differently\n%s\n%s", b, vb)
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	ast, err := parse.Parse([]string{`amount > 10 | discount = 5`}, jsonFuncMap, jsonInputMap, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SerializeASTJSON(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Version int `json:"version"`
+		AST     struct {
+			Type  string `json:"type"`
+			Rules []struct {
+				Type string `json:"type"`
+				Pos  struct {
+					Line int `json:"line"`
+				} `json:"pos"`
+				Condition struct {
+					Expression struct {
+						Type     string `json:"type"`
+						Operator string `json:"operator"`
+					} `json:"expression"`
+				} `json:"condition"`
+			} `json:"rules"`
+		} `json:"ast"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != JSONVersion || doc.AST.Type != "engine" || len(doc.AST.Rules) != 1 {
+		t.Fatalf("unexpected document %s", b)
+	}
+	cond := doc.AST.Rules[0].Condition.Expression
+	if doc.AST.Rules[0].Type != "rule" || cond.Type != "conditional" || cond.Operator != ">" {
+		t.Errorf("unexpected rule %s", b)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	for _, s := range []string{
+		`{"version":2,"ast":{"type":"engine"}}`,
+		`{"version":1,"ast":{"type":"rule"}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","condition":{"type":"expression","expression":{"type":"math","operator":"^"}}}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","condition":{"type":"expression","expression":{"type":"foo"}}}]}}`,
+		// Null and missing nodes.
+		`{"version":1,"ast":{"type":"engine","rules":[null]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","condition":{"type":"expression"}}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","condition":{"type":"expression","expression":{"type":"function","function":"f","args":[null]}}}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","condition":{"type":"expression","expression":{"type":"math","operator":"+","left":{"type":"number"},"right":null}}}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","condition":{"type":"expression","expression":{"type":"conditional","operator":">","right":{"type":"number"}}}}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","condition":{"type":"expression","expression":{"type":"not","expression":null}}}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","actions":[null]}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","actions":[{"type":"assignment","variable":{"type":"variable","name":"x"},"right":null}]}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","actions":[{"type":"assignment","operator":"=","right":{"type":"expression","expression":{"type":"null"}}}]}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","actions":[{"type":"assignment","operator":"=","variable":null,"right":{"type":"expression","expression":{"type":"null"}}}]}]}}`,
+		`{"version":1,"ast":{"type":"engine","rules":[{"type":"rule","actions":[{"type":"assignment","operator":"=","variable":{"type":"variable"},"right":{"type":"expression","expression":{"type":"null"}}}]}]}}`,
+	} {
+		if _, err := DeSerializeJSONToAST([]byte(s)); err == nil {
+			t.Errorf("expected an error for %s", s)
+		} else if strings.TrimSpace(err.Error()) == "" {
+			t.Errorf("empty error for %s", s)
+		}
+	}
+}
+
+func TestJSONNilNodes(t *testing.T) {
+	for _, n := range []parse.Node{
+		(*parse.FunctionNode)(nil),
+		(*parse.NumberNode)(nil),
+		(*parse.StringNode)(nil),
+		(*parse.IdentifierNode)(nil),
+		(*parse.MathExpressionNode)(nil),
+		(*parse.ConditionalExpressionNode)(nil),
+	} {
+		j, err := toJSON(n)
+		if err != nil || j != nil {
+			t.Errorf("toJSON(%T(nil)) = %v, %v", n, j, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package serialize
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/sazito/mosalat/eval"
+	"github.com/sazito/mosalat/internal/rulegen"
+	"github.com/sazito/mosalat/parse"
+)
+
+var genFuncMap = map[string]interface{}{
+	"half": func(n float64) float64 { return n / 2 },
+	"max": func(n ...float64) float64 {
+		m := 0.0
+		for i, v := range n {
+			if i == 0 || v > m {
+				m = v
+			}
+		}
+		return m
+	},
+}
+
+func genInputMap() map[string]interface{} {
+	return map[string]interface{}{
+		"a":    float64(3),
+		"b":    float64(-7.5),
+		"s":    "tehran",
+		"flag": true,
+		"user": map[string]interface{}{"city": "kish"},
+	}
+}
+
+func genOutputMap() map[string]interface{} {
+	return map[string]interface{}{"x": float64(1), "tags": []interface{}{}}
+}
+
+func run(ast parse.AST) string {
+	e, err := eval.New(genFuncMap, genInputMap(), genOutputMap())
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	res, err := e.Eval(ast)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return fmt.Sprint(res)
+}
+
+// TestRoundTrip checks that random rule sets decode to the tree parse.Parse
+// built and evaluate to the same outputs, or fail with the same error.
+func TestRoundTrip(t *testing.T) {
+	g := rulegen.New(1)
+	for i := 0; i < 500; i++ {
+		rules := g.Rules()
+		ast, err := parse.Parse(rules, genFuncMap, genInputMap(), genOutputMap())
+		if err != nil {
+			t.Fatalf("parse %q: %v", rules, err)
+		}
+		s, err := SerializeAST(ast)
+		if err != nil {
+			t.Fatalf("serialize %q: %v", rules, err)
+		}
+		got, err := DeSerializeToAST(s)
+		if err != nil {
+			t.Fatalf("deserialize %q: %v", rules, err)
+		}
+		if !reflect.DeepEqual(got, ast) {
+			t.Fatalf("round trip of %q changed the AST\nwant %s\ngot  %s", rules, ast, got)
+		}
+		if w, g := run(ast), run(got); w != g {
+			t.Fatalf("%q evaluates to %s after a round trip, want %s", rules, g, w)
+		}
+	}
+}
+
+// TestRoundTripValueNodes checks that value nodes, which older code and
+// hand built trees use, encode like pointers and decode to pointers.
+func TestRoundTripValueNodes(t *testing.T) {
+	ident := parse.IdentifierNode{Identifier: "a", IsInput: true}
+	cond := parse.ConditionalExpressionNode{
+		Identifier:      ">",
+		IsDiffBase:      true,
+		LeftExpression:  ident,
+		RightExpression: parse.NumberNode{IsInt: true, IsUint: true, IsFloat: true, Int64: 2, Uint64: 2, Float64: 2, Text: "2"},
+	}
+	value := parse.AST{Node: parse.EngineNode{Rules: []parse.RuleNode{{
+		Condition: &parse.ExpressionNode{Expression: cond},
+		Actions: []parse.AssingmentNode{{
+			Operator:        "=",
+			Variable:        &parse.VariableNode{Identifier: "y"},
+			RightExpression: &parse.ExpressionNode{Expression: parse.NotNode{Expression: parse.BoolNode{IsTrue: false}}},
+		}},
+	}}}}
+	ast, err := parse.Parse([]string{`a > 2 | y = !false`}, genFuncMap, genInputMap(), genOutputMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := SerializeAST(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DeSerializeToAST(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Node.(*parse.EngineNode); !ok {
+		t.Fatalf("decoded root is %T, want *parse.EngineNode", got.Node)
+	}
+	if w, g := run(ast), run(got); w != g {
+		t.Errorf("value tree evaluates to %s after a round trip, want %s", g, w)
+	}
+}
@@ -4,28 +4,58 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/sazito/mosalat/parse"
 )
 
+// nodes are registered as pointers, the shape parse.Parse builds, under the
+// names gob gives to the value types, which older blobs were written with.
+// Values and pointers of a node are encoded the same way and both decode to
+// pointers.
+var nodes = []parse.Node{
+	&parse.EngineNode{},
+	&parse.RuleNode{},
+	&parse.ExpressionNode{},
+	&parse.FunctionNode{},
+	&parse.NumberNode{},
+	&parse.StringNode{},
+	&parse.BoolNode{},
+	&parse.DurationNode{},
+	&parse.DateNode{},
+	&parse.NullNode{},
+	&parse.ExistsNode{},
+	&parse.NotNode{},
+	&parse.AssingmentNode{},
+	&parse.VariableNode{},
+	&parse.IdentifierNode{},
+	&parse.MathExpressionNode{},
+	&parse.ConditionalExpressionNode{},
+}
+
 func init() {
 	gob.Register(parse.AST{})
 
 	gob.Register(parse.Position{})
 
-	gob.Register(parse.EngineNode{})
-	gob.Register(parse.RuleNode{})
-	gob.Register(parse.ExpressionNode{})
-	gob.Register(parse.FunctionNode{})
-	gob.Register(parse.NumberNode{})
-	gob.Register(parse.StringNode{})
-	gob.Register(parse.BoolNode{})
-	gob.Register(parse.NotNode{})
-	gob.Register(parse.AssingmentNode{})
-	gob.Register(parse.VariableNode{})
-	gob.Register(parse.IdentifierNode{})
-	gob.Register(parse.MathExpressionNode{})
-	gob.Register(parse.ConditionalExpressionNode{})
+	for _, n := range nodes {
+		t := reflect.TypeOf(n).Elem()
+		gob.RegisterName(t.PkgPath()+"."+t.Name(), n)
+	}
+}
+
+// Version is the version of the format written by SerializeAST. A
+// serialized AST starts with a "v<version>:" header, blobs without a header
+// were written before the format was versioned and are version 1.
+const Version = 2
+
+// migrations[v] turns an AST decoded from version v into version v+1.
+var migrations = map[int]func(*parse.AST) error{
+	1: migrateV1,
 }
 
 func SerializeAST(m parse.AST) (string, error) {
@@ -35,10 +65,16 @@ func SerializeAST(m parse.AST) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(b.Bytes()), nil
+	return fmt.Sprintf("v%d:", Version) + base64.StdEncoding.EncodeToString(b.Bytes()), nil
 }
 
+// DeSerializeToAST decodes an AST written by SerializeAST, ASTs written by
+// older versions are migrated to the current one.
 func DeSerializeToAST(str string) (parse.AST, error) {
+	version, str, err := splitHeader(str)
+	if err != nil {
+		return parse.AST{}, err
+	}
 	m := parse.AST{}
 	by, err := base64.StdEncoding.DecodeString(str)
 	if err != nil {
@@ -51,5 +87,55 @@ func DeSerializeToAST(str string) (parse.AST, error) {
 	if err != nil {
 		return parse.AST{}, err
 	}
+	for v := version; v < Version; v++ {
+		if err := migrations[v](&m); err != nil {
+			return parse.AST{}, fmt.Errorf("migrating from version %d: %w", v, err)
+		}
+	}
 	return m, nil
 }
+
+// splitHeader returns the version of a serialized AST and its payload. The
+// base64 alphabet has no ':', so a payload is never taken for a header.
+func splitHeader(str string) (int, string, error) {
+	if strings.HasPrefix(str, signedPrefix) {
+		return 0, "", errors.New("signed rule set, decode it with DeSerializeSignedToAST")
+	}
+	i := strings.IndexByte(str, ':')
+	if i < 0 {
+		return 1, str, nil
+	}
+	if str[0] != 'v' {
+		return 0, "", fmt.Errorf("malformed version header %q", str[:i])
+	}
+	v, err := strconv.Atoi(str[1:i])
+	if err != nil || v < 1 {
+		return 0, "", fmt.Errorf("malformed version header %q", str[:i])
+	}
+	if v > Version {
+		return 0, "", fmt.Errorf("unsupported version %d, newest known version is %d", v, Version)
+	}
+	return v, str[i+1:], nil
+}
+
+// migrateV1 sets the operator of assignments, version 1 only had plain
+// assignments and no AssingmentNode.Operator.
+func migrateV1(m *parse.AST) error {
+	var rules []parse.RuleNode
+	switch n := m.Node.(type) {
+	case *parse.EngineNode:
+		rules = n.Rules
+	case parse.EngineNode:
+		rules = n.Rules
+	default:
+		return fmt.Errorf("unexpected root node %T", m.Node)
+	}
+	for i := range rules {
+		for j := range rules[i].Actions {
+			if rules[i].Actions[j].Operator == "" {
+				rules[i].Actions[j].Operator = "="
+			}
+		}
+	}
+	return nil
+}
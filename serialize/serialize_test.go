@@ -0,0 +1,140 @@
+package serialize
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sazito/mosalat/eval"
+	"github.com/sazito/mosalat/parse"
+)
+
+var update = flag.Bool("update", false, "rewrite the fixtures of the current version")
+
+var goldenFuncMap = map[string]interface{}{
+	"days": func(n float64) float64 { return n * 24 * 60 * 60 },
+}
+
+var goldenInputMap = map[string]interface{}{
+	"registered_date": float64(0),
+	"sales_amount":    float64(2000),
+	"vip":             false,
+}
+
+func goldenOutputMap() map[string]interface{} {
+	return map[string]interface{}{"plan_name": "premium_1"}
+}
+
+// TestGolden decodes the fixtures of every version in testdata/v<version>,
+// each <name>.v<version> is the serialized form of the rules in <name>.rules
+// as written by that version, and checks the decoded AST is the one the
+// current parser builds.
+func TestGolden(t *testing.T) {
+	if *update {
+		writeFixtures(t)
+	}
+	for v := 1; v <= Version; v++ {
+		files, err := filepath.Glob(fmt.Sprintf("testdata/v%d/*.v%d", v, v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Errorf("no fixtures for version %d", v)
+		}
+		for _, f := range files {
+			name := strings.TrimSuffix(f, filepath.Ext(f))
+			t.Run(fmt.Sprintf("v%d/%s", v, filepath.Base(name)), func(t *testing.T) {
+				blob, err := ioutil.ReadFile(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := parseFixture(t, name+".rules")
+				got, err := DeSerializeToAST(strings.TrimSpace(string(blob)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				wj, err := SerializeASTJSON(want)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gj, err := SerializeASTJSON(got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(wj) != string(gj) {
+					t.Errorf("decoded AST differs from the parsed one\nwant %s\ngot  %s", wj, gj)
+				}
+				if w, g := evaluate(t, want), evaluate(t, got); !reflect.DeepEqual(w, g) {
+					t.Errorf("decoded AST evaluates to %v, want %v", g, w)
+				}
+			})
+		}
+	}
+}
+
+func TestVersionHeader(t *testing.T) {
+	ast := parseFixture(t, "testdata/v1/plan.rules")
+	s, err := SerializeAST(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s, fmt.Sprintf("v%d:", Version)) {
+		t.Errorf("missing version header in %.10q", s)
+	}
+	for _, bad := range []string{
+		fmt.Sprintf("v%d:", Version+1) + s[strings.IndexByte(s, ':')+1:],
+		"x2:" + s[strings.IndexByte(s, ':')+1:],
+		"v:abc",
+	} {
+		if _, err := DeSerializeToAST(bad); err == nil {
+			t.Errorf("expected an error for header %.5q", bad)
+		}
+	}
+}
+
+func parseFixture(t *testing.T, path string) parse.AST {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := strings.Split(strings.TrimSpace(string(b)), "\n")
+	ast, err := parse.Parse(rules, goldenFuncMap, goldenInputMap, goldenOutputMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ast
+}
+
+func evaluate(t *testing.T, ast parse.AST) map[string]interface{} {
+	e, err := eval.New(goldenFuncMap, goldenInputMap, goldenOutputMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := e.Eval(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func writeFixtures(t *testing.T) {
+	dir := fmt.Sprintf("testdata/v%d", Version)
+	files, err := filepath.Glob(dir + "/*.rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		s, err := SerializeAST(parseFixture(t, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := strings.TrimSuffix(f, ".rules") + fmt.Sprintf(".v%d", Version)
+		if err := ioutil.WriteFile(out, []byte(s+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package serialize
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+// Algorithm is the signature algorithm of a key.
+type Algorithm string
+
+const (
+	HMACSHA256 Algorithm = "hs256"
+	Ed25519    Algorithm = "ed25519"
+)
+
+// signedPrefix starts every signed envelope, the envelope is
+// "mosalat-signed:v1:<algorithm>:<key id>:<signature>:<payload>" and the
+// signature covers everything but itself.
+const signedPrefix = "mosalat-signed:v1:"
+
+// Key signs or verifies envelopes. An Ed25519 key without a private key can
+// only verify.
+type Key struct {
+	ID         string
+	Algorithm  Algorithm
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+// NewHMACKey returns an HMAC-SHA256 key, the same key signs and verifies.
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("empty HMAC secret")
+	}
+	return newKey(id, HMACSHA256, &Key{secret: secret})
+}
+
+// NewEd25519Key returns a key that signs with priv and verifies with its
+// public key.
+func NewEd25519Key(id string, priv ed25519.PrivateKey) (*Key, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid Ed25519 private key")
+	}
+	return newKey(id, Ed25519, &Key{privateKey: priv, publicKey: priv.Public().(ed25519.PublicKey)})
+}
+
+// NewEd25519VerifyKey returns a key that only verifies, for the services
+// that load rule sets but never sign them.
+func NewEd25519VerifyKey(id string, pub ed25519.PublicKey) (*Key, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 public key")
+	}
+	return newKey(id, Ed25519, &Key{publicKey: pub})
+}
+
+func newKey(id string, alg Algorithm, k *Key) (*Key, error) {
+	if id == "" || strings.ContainsRune(id, ':') {
+		return nil, fmt.Errorf("invalid key id %q", id)
+	}
+	k.ID = id
+	k.Algorithm = alg
+	return k, nil
+}
+
+func (k *Key) sign(msg []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case HMACSHA256:
+		m := hmac.New(sha256.New, k.secret)
+		m.Write(msg)
+		return m.Sum(nil), nil
+	case Ed25519:
+		if k.privateKey == nil {
+			return nil, fmt.Errorf("key %q can only verify", k.ID)
+		}
+		return ed25519.Sign(k.privateKey, msg), nil
+	}
+	return nil, fmt.Errorf("unknown algorithm %q", k.Algorithm)
+}
+
+func (k *Key) verify(msg, sig []byte) bool {
+	switch k.Algorithm {
+	case HMACSHA256:
+		m := hmac.New(sha256.New, k.secret)
+		m.Write(msg)
+		return hmac.Equal(m.Sum(nil), sig)
+	case Ed25519:
+		return ed25519.Verify(k.publicKey, msg, sig)
+	}
+	return false
+}
+
+// Keyring holds the keys envelopes are verified with by key id. Keeping the
+// old key next to the new one while rotating lets both verify.
+type Keyring map[string]*Key
+
+func NewKeyring(keys ...*Key) Keyring {
+	r := make(Keyring, len(keys))
+	for _, k := range keys {
+		r[k.ID] = k
+	}
+	return r
+}
+
+// SignatureError reports an envelope that failed verification.
+type SignatureError struct {
+	KeyID  string
+	Reason string
+}
+
+func (e *SignatureError) Error() string {
+	if e.KeyID == "" {
+		return "signature error: " + e.Reason
+	}
+	return fmt.Sprintf("signature error: key %q: %s", e.KeyID, e.Reason)
+}
+
+// Sign wraps a serialized rule set, in any of the encodings of this package,
+// in an envelope signed with key.
+func Sign(payload []byte, key *Key) (string, error) {
+	header := signedPrefix + string(key.Algorithm) + ":" + key.ID + ":"
+	sig, err := key.sign(signedMessage(header, payload))
+	if err != nil {
+		return "", err
+	}
+	return header + base64.RawURLEncoding.EncodeToString(sig) + ":" + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// Verify checks the signature of an envelope with the key of its key id and
+// returns the payload. Every failure is a *SignatureError.
+func Verify(envelope string, keys Keyring) ([]byte, error) {
+	if !strings.HasPrefix(envelope, signedPrefix) {
+		return nil, &SignatureError{Reason: "not a signed envelope"}
+	}
+	parts := strings.SplitN(envelope[len(signedPrefix):], ":", 4)
+	if len(parts) != 4 {
+		return nil, &SignatureError{Reason: "malformed envelope"}
+	}
+	alg, id := Algorithm(parts[0]), parts[1]
+	key, ok := keys[id]
+	if !ok {
+		return nil, &SignatureError{KeyID: id, Reason: "unknown key"}
+	}
+	if key.Algorithm != alg {
+		return nil, &SignatureError{KeyID: id, Reason: fmt.Sprintf("envelope is signed with %s, key is %s", alg, key.Algorithm)}
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, &SignatureError{KeyID: id, Reason: "malformed signature"}
+	}
+	payload, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, &SignatureError{KeyID: id, Reason: "malformed payload"}
+	}
+	header := signedPrefix + parts[0] + ":" + id + ":"
+	if !key.verify(signedMessage(header, payload), sig) {
+		return nil, &SignatureError{KeyID: id, Reason: "invalid signature"}
+	}
+	return payload, nil
+}
+
+func signedMessage(header string, payload []byte) []byte {
+	return append([]byte(header), payload...)
+}
+
+// SignAST serializes the AST with SerializeAST and signs it.
+func SignAST(m parse.AST, key *Key) (string, error) {
+	s, err := SerializeAST(m)
+	if err != nil {
+		return "", err
+	}
+	return Sign([]byte(s), key)
+}
+
+// DeSerializeSignedToAST verifies an envelope written by SignAST and only
+// then decodes the AST in it.
+func DeSerializeSignedToAST(envelope string, keys Keyring) (parse.AST, error) {
+	payload, err := Verify(envelope, keys)
+	if err != nil {
+		return parse.AST{}, err
+	}
+	return DeSerializeToAST(string(payload))
+}
@@ -0,0 +1,113 @@
+package serialize
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sazito/mosalat/parse"
+)
+
+func signKeys(t *testing.T) (hmacKey, edKey, edVerify *Key) {
+	var err error
+	if hmacKey, err = NewHMACKey("h1", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	priv := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if edKey, err = NewEd25519Key("e1", priv); err != nil {
+		t.Fatal(err)
+	}
+	if edVerify, err = NewEd25519VerifyKey("e1", priv.Public().(ed25519.PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestSignedRoundTrip(t *testing.T) {
+	hmacKey, edKey, edVerify := signKeys(t)
+	ast, err := parse.Parse(jsonRules[1], jsonFuncMap, jsonInputMap, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		sign   *Key
+		verify Keyring
+	}{
+		{hmacKey, NewKeyring(hmacKey)},
+		{edKey, NewKeyring(edVerify)},
+		{edKey, NewKeyring(hmacKey, edKey)},
+	} {
+		env, err := SignAST(ast, c.sign)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DeSerializeSignedToAST(env, c.verify)
+		if err != nil {
+			t.Fatalf("%s: %v", c.sign.Algorithm, err)
+		}
+		if got.String() != ast.String() {
+			t.Errorf("%s: signed round trip changed the AST", c.sign.Algorithm)
+		}
+	}
+	b, err := SerializeASTBinary(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := Sign(b, edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := Verify(env, NewKeyring(edVerify))
+	if err != nil || string(payload) != string(b) {
+		t.Errorf("binary payload did not survive signing: %v", err)
+	}
+}
+
+func TestSignatureErrors(t *testing.T) {
+	hmacKey, _, edVerify := signKeys(t)
+	ast, err := parse.Parse(jsonRules[0], jsonFuncMap, jsonInputMap, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := SignAST(ast, hmacKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewHMACKey("h1", []byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.LastIndexByte(env, ':')
+	tampered := env[:i+1] + "A" + env[i+2:]
+	if tampered == env {
+		tampered = env[:i+1] + "B" + env[i+2:]
+	}
+	renamed := strings.Replace(env, ":h1:", ":e1:", 1)
+	for name, c := range map[string]struct {
+		env  string
+		keys Keyring
+	}{
+		"tampered payload": {tampered, NewKeyring(hmacKey)},
+		"wrong secret":     {env, NewKeyring(other)},
+		"unknown key":      {env, NewKeyring(edVerify)},
+		"algorithm swap":   {renamed, NewKeyring(edVerify)},
+		"unsigned":         {env[strings.LastIndexByte(env, ':')+1:], NewKeyring(hmacKey)},
+		"truncated":        {env[:len(signedPrefix)+6], NewKeyring(hmacKey)},
+	} {
+		_, err := DeSerializeSignedToAST(c.env, c.keys)
+		var se *SignatureError
+		if !errors.As(err, &se) {
+			t.Errorf("%s: got %v, want a *SignatureError", name, err)
+		}
+	}
+	if _, err := SignAST(ast, edVerify); err == nil {
+		t.Error("a verify only key must not sign")
+	}
+	if _, err := DeSerializeToAST(env); err == nil {
+		t.Error("DeSerializeToAST must not decode a signed envelope")
+	}
+	if _, err := NewHMACKey("a:b", []byte("x")); err == nil {
+		t.Error("key ids must not contain ':'")
+	}
+}
@@ -0,0 +1,77 @@
+package stdlib
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// length returns the number of characters of a string, or the number of
+// elements of a list or a map.
+func length(v interface{}) (float64, error) {
+	if v == nil {
+		return 0, nil
+	}
+	if s, ok := v.(string); ok {
+		return float64(utf8.RuneCountInString(s)), nil
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.String:
+		return float64(rv.Len()), nil
+	}
+	return 0, fmt.Errorf("len of %T", v)
+}
+
+func sum(values ...float64) float64 {
+	var s float64
+	for _, v := range values {
+		s += v
+	}
+	return s
+}
+
+// avg returns the arithmetic mean of the values.
+func avg(values ...float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, fmt.Errorf("avg of no values")
+	}
+	return sum(values...) / float64(len(values)), nil
+}
+
+// includes reports whether list has an element equal to v. Numbers are
+// equal when their values are, whatever their go types.
+func includes(list interface{}, v interface{}) (bool, error) {
+	if list == nil {
+		return false, nil
+	}
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return false, fmt.Errorf("includes on %T", list)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if equal(rv.Index(i).Interface(), v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+var floatType = reflect.TypeOf(float64(0))
+
+func equal(a, b interface{}) bool {
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	if av.IsValid() && bv.IsValid() && isNumber(av.Kind()) && isNumber(bv.Kind()) {
+		return av.Convert(floatType).Float() == bv.Convert(floatType).Float()
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package stdlib
+
+import (
+	"time"
+
+	"github.com/sazito/mosalat/jalali"
+)
+
+func jalaliYear(t time.Time) (float64, error) {
+	y, _, _, err := jalali.FromTime(t)
+	return float64(y), err
+}
+
+func jalaliMonth(t time.Time) (float64, error) {
+	_, m, _, err := jalali.FromTime(t)
+	return float64(m), err
+}
+
+func jalaliDay(t time.Time) (float64, error) {
+	_, _, d, err := jalali.FromTime(t)
+	return float64(d), err
+}
+
+// jalaliWeekday returns the day of the week of t, from 0 for saturday to
+// 6 for friday.
+func jalaliWeekday(t time.Time) float64 {
+	return float64(jalali.Weekday(t))
+}
+
+// jalaliAddMonths adds jalali months to t, clamping the day to the length
+// of the resulting month.
+func jalaliAddMonths(t time.Time, months int) (time.Time, error) {
+	return jalali.AddMonths(t, months)
+}
+
+// jalaliDate returns the start of a jalali date in UTC.
+func jalaliDate(year, month, day int) (time.Time, error) {
+	return jalali.Date(year, month, day, 0, 0, 0, time.UTC)
+}
+
+func jalaliIsLeap(year int) bool {
+	return jalali.IsLeap(year)
+}
@@ -0,0 +1,58 @@
+package stdlib
+
+import (
+	"fmt"
+	"math"
+)
+
+// min returns the smallest of the values.
+func min(values ...float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, fmt.Errorf("min of no values")
+	}
+	m := values[0]
+	for _, v := range values[1:] {
+		m = math.Min(m, v)
+	}
+	return m, nil
+}
+
+// max returns the largest of the values.
+func max(values ...float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, fmt.Errorf("max of no values")
+	}
+	m := values[0]
+	for _, v := range values[1:] {
+		m = math.Max(m, v)
+	}
+	return m, nil
+}
+
+func abs(x float64) float64 {
+	return math.Abs(x)
+}
+
+// round returns the nearest integer, rounding half away from zero.
+func round(x float64) float64 {
+	return math.Round(x)
+}
+
+func floor(x float64) float64 {
+	return math.Floor(x)
+}
+
+func ceil(x float64) float64 {
+	return math.Ceil(x)
+}
+
+func pow(x, y float64) float64 {
+	return math.Pow(x, y)
+}
+
+func sqrt(x float64) (float64, error) {
+	if x < 0 {
+		return 0, fmt.Errorf("sqrt of negative number %v", x)
+	}
+	return math.Sqrt(x), nil
+}
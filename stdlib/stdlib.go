@@ -0,0 +1,117 @@
+// Package stdlib is an opt-in library of functions for funcMap.
+package stdlib
+
+import (
+	"fmt"
+	"sort"
+)
+
+var funcs = map[string]interface{}{
+	// math
+	"min":   min,
+	"max":   max,
+	"abs":   abs,
+	"round": round,
+	"floor": floor,
+	"ceil":  ceil,
+	"pow":   pow,
+	"sqrt":  sqrt,
+	// strings
+	"lower":       lower,
+	"upper":       upper,
+	"trim":        trim,
+	"contains":    contains,
+	"starts_with": startsWith,
+	"ends_with":   endsWith,
+	"replace":     replace,
+	"concat":      concat,
+	// time
+	"now":       now,
+	"days":      days,
+	"hours":     hours,
+	"minutes":   minutes,
+	"unix":      unix,
+	"from_unix": fromUnix,
+	// jalali calendar
+	"jalali_year":       jalaliYear,
+	"jalali_month":      jalaliMonth,
+	"jalali_day":        jalaliDay,
+	"jalali_weekday":    jalaliWeekday,
+	"jalali_add_months": jalaliAddMonths,
+	"jalali_date":       jalaliDate,
+	"jalali_is_leap":    jalaliIsLeap,
+	// collections
+	"len":      length,
+	"sum":      sum,
+	"avg":      avg,
+	"includes": includes,
+}
+
+// Funcs returns a new map holding every standard function. The caller must
+// call Validate on the inputs and outputs evaluated with it, an input or
+// output with the name of a standard function is shadowed by the function.
+func Funcs() map[string]interface{} {
+	m := make(map[string]interface{}, len(funcs))
+	for k, v := range funcs {
+		m[k] = v
+	}
+	return m
+}
+
+// Names returns the sorted names of the standard functions.
+func Names() []string {
+	names := make([]string, 0, len(funcs))
+	for k := range funcs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reserved reports whether name is the name of a standard function.
+func Reserved(name string) bool {
+	_, ok := funcs[name]
+	return ok
+}
+
+// Override decides what Merge does with a funcMap entry that has the name
+// of a standard function.
+type Override int
+
+const (
+	NoOverride   Override = iota // the entry is an error
+	PreferUser                   // the entry replaces the standard function
+	PreferStdlib                 // the standard function replaces the entry
+)
+
+// Merge returns a new map holding the standard functions and funcMap. As
+// with Funcs, the caller must call Validate on the inputs and outputs.
+func Merge(funcMap map[string]interface{}, override Override) (map[string]interface{}, error) {
+	m := Funcs()
+	for k, v := range funcMap {
+		if _, ok := funcs[k]; ok {
+			switch override {
+			case PreferUser:
+			case PreferStdlib:
+				continue
+			default:
+				return nil, fmt.Errorf("function %q is reserved by stdlib", k)
+			}
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// Validate returns an error if a key of the input or output map has the
+// name of a standard function and would be shadowed by it.
+func Validate(inputMap, outputMap map[string]interface{}) error {
+	for _, m := range []map[string]interface{}{inputMap, outputMap} {
+		for k := range m {
+			if Reserved(k) {
+				return fmt.Errorf("%q is reserved by stdlib", k)
+			}
+		}
+	}
+	return nil
+}
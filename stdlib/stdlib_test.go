@@ -0,0 +1,192 @@
+package stdlib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sazito/mosalat/eval"
+	"github.com/sazito/mosalat/parse"
+)
+
+var (
+	// 1403/01/01, a wednesday.
+	nowruz = time.Date(2024, 3, 20, 12, 30, 0, 0, time.UTC)
+
+	testInputs = map[string]interface{}{
+		"t":     nowruz,
+		"zero":  time.Time{},
+		"list":  []interface{}{1.0, "a", 3},
+		"nums":  []float64{1, 2, 3},
+		"m":     map[string]interface{}{"a": 1, "b": 2},
+		"s":     " Hi ",
+		"half":  1.5,
+		"empty": []interface{}{},
+	}
+)
+
+func evalString(t *testing.T, expr string) (interface{}, error) {
+	t.Helper()
+	funcMap := Funcs()
+	node, err := parse.ParseExpression(expr, funcMap, testInputs, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", expr, err)
+	}
+	e, err := eval.New(funcMap, testInputs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.EvalExpression(node)
+}
+
+func TestFuncs(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		want interface{}
+		err  string
+	}{
+		// math
+		{expr: "min(3, 1, 2)", want: 1.0},
+		{expr: "min(nums)", want: 1.0},
+		{expr: "min()", err: "min of no values"},
+		{expr: "max(3, 1, 2)", want: 3.0},
+		{expr: "max(-1)", want: -1.0},
+		{expr: "max()", err: "max of no values"},
+		{expr: "abs(-2.5)", want: 2.5},
+		{expr: "round(2.5)", want: 3.0},
+		{expr: "round(-2.5)", want: -3.0},
+		{expr: "floor(-1.5)", want: -2.0},
+		{expr: "ceil(1.2)", want: 2.0},
+		{expr: "pow(2, 10)", want: 1024.0},
+		{expr: "sqrt(16)", want: 4.0},
+		{expr: "sqrt(-1)", err: "sqrt of negative number -1"},
+		// strings
+		{expr: `lower("ABC")`, want: "abc"},
+		{expr: `upper("abc")`, want: "ABC"},
+		{expr: "trim(s)", want: "Hi"},
+		{expr: `contains("mosalat", "sal")`, want: true},
+		{expr: `contains("mosalat", "x")`, want: false},
+		{expr: `starts_with("mosalat", "mo")`, want: true},
+		{expr: `ends_with("mosalat", "mo")`, want: false},
+		{expr: `replace("a-b-c", "-", "+")`, want: "a+b+c"},
+		{expr: `concat("a", "b", "c")`, want: "abc"},
+		{expr: "concat()", want: ""},
+		// time
+		{expr: "days(2)", want: 48 * time.Hour},
+		{expr: "days(0.5)", want: 12 * time.Hour},
+		{expr: "hours(1.5)", want: 90 * time.Minute},
+		{expr: "minutes(2)", want: 2 * time.Minute},
+		{expr: "unix(t)", want: nowruz.Unix()},
+		{expr: "from_unix(1710937800)", want: nowruz},
+		{expr: "from_unix(unix(t))", want: nowruz},
+		// jalali calendar
+		{expr: "jalali_year(t)", want: 1403.0},
+		{expr: "jalali_month(t)", want: 1.0},
+		{expr: "jalali_day(t)", want: 1.0},
+		{expr: "jalali_weekday(t)", want: 4.0},
+		{expr: "jalali_add_months(t, 12)", want: time.Date(2025, 3, 21, 12, 30, 0, 0, time.UTC)},
+		{expr: "jalali_add_months(t, half)", err: "argument 2"},
+		{expr: "jalali_year(zero)", err: "jalali year -621 out of range"},
+		{expr: "jalali_add_months(zero, 1)", err: "out of range"},
+		{expr: "jalali_date(1403, 1, 1)", want: time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)},
+		{expr: "jalali_date(1403, 13, 1)", err: "jalali"},
+		{expr: "jalali_is_leap(1403)", want: true},
+		{expr: "jalali_is_leap(1404)", want: false},
+		// collections
+		{expr: "len(list)", want: 3.0},
+		{expr: "len(m)", want: 2.0},
+		{expr: `len("سلام")`, want: 4.0},
+		{expr: "len(null)", want: 0.0},
+		{expr: "len(1)", err: "len of float64"},
+		{expr: "sum(nums)", want: 6.0},
+		{expr: "sum()", want: 0.0},
+		{expr: "avg(1, 2, 6)", want: 3.0},
+		{expr: "avg(empty)", err: "avg of no values"},
+		{expr: "includes(list, 3)", want: true},
+		{expr: `includes(list, "a")`, want: true},
+		{expr: `includes(list, "b")`, want: false},
+		{expr: "includes(null, 1)", want: false},
+		{expr: `includes("abc", "a")`, err: "includes on string"},
+	} {
+		got, err := evalString(t, c.expr)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error %v, want %q", c.expr, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if want, ok := c.want.(time.Time); ok {
+			if got, ok := got.(time.Time); !ok || !got.Equal(want) || got.Location() != time.UTC {
+				t.Errorf("%s = %v, want %v", c.expr, got, want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s = %#v, want %#v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestNow(t *testing.T) {
+	before := time.Now()
+	got, err := evalString(t, "now()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now, ok := got.(time.Time); !ok || now.Before(before) || now.After(time.Now()) {
+		t.Errorf("now() = %v", got)
+	}
+}
+
+func TestNamesCoverFuncs(t *testing.T) {
+	names := Names()
+	if len(names) != len(Funcs()) {
+		t.Fatalf("%d names for %d functions", len(names), len(Funcs()))
+	}
+	for _, name := range names {
+		if !Reserved(name) {
+			t.Errorf("%s is not reserved", name)
+		}
+	}
+	if Reserved("discount") {
+		t.Error("discount is reserved")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	user := func(x float64) float64 { return x }
+	if _, err := Merge(map[string]interface{}{"abs": user}, NoOverride); err == nil {
+		t.Error("Merge over abs without an override: no error")
+	}
+	m, err := Merge(map[string]interface{}{"abs": user, "mine": user}, PreferUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.ValueOf(m["abs"]).Pointer() != reflect.ValueOf(user).Pointer() || m["mine"] == nil {
+		t.Error("PreferUser kept the standard abs")
+	}
+	m, err = Merge(map[string]interface{}{"abs": user}, PreferStdlib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.ValueOf(m["abs"]).Pointer() != reflect.ValueOf(abs).Pointer() {
+		t.Error("PreferStdlib replaced the standard abs")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(map[string]interface{}{"total": 1}, map[string]interface{}{"discount": 0}); err != nil {
+		t.Error(err)
+	}
+	if err := Validate(map[string]interface{}{"len": 1}, nil); err == nil {
+		t.Error("input len: no error")
+	}
+	if err := Validate(nil, map[string]interface{}{"max": 0}); err == nil {
+		t.Error("output max: no error")
+	}
+}
@@ -0,0 +1,37 @@
+package stdlib
+
+import "strings"
+
+func lower(s string) string {
+	return strings.ToLower(s)
+}
+
+func upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+// trim removes the leading and trailing white space.
+func trim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+func contains(s, substr string) bool {
+	return strings.Contains(s, substr)
+}
+
+func startsWith(s, prefix string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+func endsWith(s, suffix string) bool {
+	return strings.HasSuffix(s, suffix)
+}
+
+// replace replaces every occurrence of old in s with new.
+func replace(s, old, new string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+func concat(parts ...string) string {
+	return strings.Join(parts, "")
+}
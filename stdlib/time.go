@@ -0,0 +1,30 @@
+package stdlib
+
+import "time"
+
+// now returns the current time.
+func now() time.Time {
+	return time.Now()
+}
+
+func days(count float64) time.Duration {
+	return time.Duration(count * float64(24*time.Hour))
+}
+
+func hours(count float64) time.Duration {
+	return time.Duration(count * float64(time.Hour))
+}
+
+func minutes(count float64) time.Duration {
+	return time.Duration(count * float64(time.Minute))
+}
+
+// unix returns t in unix seconds.
+func unix(t time.Time) int64 {
+	return t.Unix()
+}
+
+// fromUnix returns the time of sec unix seconds.
+func fromUnix(sec int64) time.Time {
+	return time.Unix(sec, 0).UTC()
+}